@@ -2,27 +2,80 @@ package archive
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/FirinKinuo/capyback/filter"
+	"github.com/FirinKinuo/capyback/index"
+	"github.com/FirinKinuo/capyback/progress"
 	"github.com/mholt/archiver/v4"
+	"hash"
 	"io"
+	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
 )
 
+// ErrorSourceRead is an error when files or a stream to archive can not be read.
+var ErrorSourceRead = errors.New("read source")
+
+// Option configures an ArchiverAdapter.
+type Option func(a *ArchiverAdapter)
+
+// WithFilter excludes files matched by the filter from archives.
+func WithFilter(f *filter.Filter) Option {
+	return func(a *ArchiverAdapter) {
+		a.filter = f
+	}
+}
+
+// WithIndex records archived files in the index builder, and archives only files changed since its parent.
+func WithIndex(b *index.Builder) Option {
+	return func(a *ArchiverAdapter) {
+		a.index = b
+	}
+}
+
+// WithProgress counts read files in the tracker, the total size of files is set before archiving.
+func WithProgress(t *progress.Tracker) Option {
+	return func(a *ArchiverAdapter) {
+		a.progress = t
+	}
+}
+
+// WithSpool spools streams into files in the directory, which must not exceed maxSize.
+// The default directory for temporary files is used when the directory is empty, maxSize <= 0 means no limit.
+func WithSpool(directory string, maxSize int64) Option {
+	return func(a *ArchiverAdapter) {
+		a.spoolDirectory = directory
+		a.spoolMaxSize = maxSize
+	}
+}
+
 type ArchiverAdapter struct {
 	archiver archiver.Archival
-}
+	filter   *filter.Filter
+	index    *index.Builder
+	progress *progress.Tracker
 
-func NewArchiverAdapter(archiver archiver.Archival) *ArchiverAdapter {
-	return &ArchiverAdapter{archiver: archiver}
+	spoolDirectory string
+	spoolMaxSize   int64
 }
 
-func (a *ArchiverAdapter) Format() string {
-	archiverExtension := a.archiver.Name()
-	if len(archiverExtension) > 1 {
-		return archiverExtension[1:]
+func NewArchiverAdapter(archiver archiver.Archival, options ...Option) *ArchiverAdapter {
+	adapter := &ArchiverAdapter{archiver: archiver}
+
+	for _, option := range options {
+		option(adapter)
 	}
 
-	return archiverExtension
+	return adapter
+}
+
+func (a *ArchiverAdapter) Format() string {
+	return formatName(a.archiver.Name())
 }
 
 func (a *ArchiverAdapter) Archive(ctx context.Context, output io.Writer, files []string) error {
@@ -31,20 +84,231 @@ func (a *ArchiverAdapter) Archive(ctx context.Context, output io.Writer, files [
 		return fmt.Errorf("prepare file list: %w", err)
 	}
 
+	if a.progress != nil {
+		a.trackFiles(archiverFiles)
+	}
+
 	return a.archiver.Archive(ctx, output, archiverFiles)
 }
 
+// trackFiles sets the total size of regular files and counts files and their content, while the archiver reads them.
+func (a *ArchiverAdapter) trackFiles(files []archiver.File) {
+	var total int64
+
+	for i := range files {
+		file := &files[i]
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		total += file.Size()
+
+		open, nameInArchive := file.Open, file.NameInArchive
+
+		file.Open = func() (io.ReadCloser, error) {
+			content, err := open()
+			if err != nil {
+				return nil, err
+			}
+
+			a.progress.StartFile(nameInArchive)
+
+			return &progressReadCloser{ReadCloser: content, tracker: a.progress}, nil
+		}
+	}
+
+	a.progress.SetTotal(total)
+}
+
+// progressReadCloser counts read content in the tracker.
+type progressReadCloser struct {
+	io.ReadCloser
+	tracker *progress.Tracker
+}
+
+func (p *progressReadCloser) Read(b []byte) (n int, err error) {
+	n, err = p.ReadCloser.Read(b)
+	p.tracker.AddSource(int64(n))
+
+	return n, err
+}
+
+// Summary describes files, which would be archived.
+type Summary struct {
+	// Entries is the number of archive entries, Files is the number of regular files among them.
+	Entries int
+	Files   int
+	// Size is the total size of regular files.
+	Size int64
+}
+
+// Scan walks the files like Archive does, with the filter and the index, without reading them.
+func (a *ArchiverAdapter) Scan(_ context.Context, files []string) (Summary, error) {
+	archiverFiles, err := a.convertFilesToArchiveFiles(files)
+	if err != nil {
+		return Summary{}, fmt.Errorf("prepare file list: %w", err)
+	}
+
+	summary := Summary{Entries: len(archiverFiles)}
+
+	for _, file := range archiverFiles {
+		if file.Mode().IsRegular() {
+			summary.Files++
+			summary.Size += file.Size()
+		}
+	}
+
+	return summary, nil
+}
+
 func (a *ArchiverAdapter) convertFilesToArchiveFiles(files []string) ([]archiver.File, error) {
-	filesMap := make(map[string]string, len(files))
+	var archiveFiles []archiver.File
 
 	for _, file := range files {
-		filesMap[file] = filepath.Base(file)
+		rootFiles, err := a.walkFiles(file, filepath.Base(file))
+		if err != nil {
+			return nil, fmt.Errorf("convert source path to archive files: %w: %w", ErrorSourceRead, err)
+		}
+
+		archiveFiles = append(archiveFiles, rootFiles...)
 	}
 
-	archiveFiles, err := archiver.FilesFromDisk(nil, filesMap)
+	return archiveFiles, nil
+}
+
+// walkFiles walks the tree of root on disk and returns files not excluded by the filter,
+// placed into rootInArchive. Excluded directories are not walked.
+func (a *ArchiverAdapter) walkFiles(root string, rootInArchive string) ([]archiver.File, error) {
+	var files []archiver.File
+	var walker *filter.Walker
+
+	if a.filter != nil {
+		walker = a.filter.NewWalker(root)
+	}
+
+	err := filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+
+		if walker != nil && relativePath != "." {
+			if walker.Excluded(relativePath, entry.IsDir()) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+		}
+
+		if walker != nil && entry.IsDir() {
+			err = walker.EnterDir(relativePath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+
+		file, err := a.diskFile(name, entry, path.Join(rootInArchive, filepath.ToSlash(relativePath)))
+		if err != nil {
+			return err
+		}
+
+		if a.index != nil && !a.indexFile(&file) {
+			return nil
+		}
+
+		files = append(files, file)
+
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("convert source path to archive files: %w", err)
+		return nil, err
 	}
 
-	return archiveFiles, nil
+	return files, nil
+}
+
+// indexFile adds the file to the index and reports whether it must be archived.
+// Content of archived regular files is hashed while the archiver reads it.
+func (a *ArchiverAdapter) indexFile(file *archiver.File) bool {
+	if !a.index.Add(file.NameInArchive, file.FileInfo) {
+		return false
+	}
+
+	if !file.Mode().IsRegular() {
+		return true
+	}
+
+	open, nameInArchive := file.Open, file.NameInArchive
+
+	file.Open = func() (io.ReadCloser, error) {
+		content, err := open()
+		if err != nil {
+			return nil, err
+		}
+
+		return &hashingReadCloser{
+			ReadCloser: content,
+			hash:       sha256.New(),
+			onEOF: func(hash string) {
+				a.index.SetHash(nameInArchive, hash)
+			},
+		}, nil
+	}
+
+	return true
+}
+
+// hashingReadCloser hashes read content and passes the hex hash to onEOF, when the content is read to the end.
+type hashingReadCloser struct {
+	io.ReadCloser
+	hash  hash.Hash
+	onEOF func(hash string)
+}
+
+func (h *hashingReadCloser) Read(p []byte) (n int, err error) {
+	n, err = h.ReadCloser.Read(p)
+	h.hash.Write(p[:n])
+
+	if errors.Is(err, io.EOF) && h.onEOF != nil {
+		h.onEOF(hex.EncodeToString(h.hash.Sum(nil)))
+		h.onEOF = nil
+	}
+
+	return n, err
+}
+
+// diskFile describes a file on disk for the archiver, symbolic links are preserved.
+func (a *ArchiverAdapter) diskFile(name string, entry fs.DirEntry, nameInArchive string) (archiver.File, error) {
+	info, err := entry.Info()
+	if err != nil {
+		return archiver.File{}, err
+	}
+
+	var linkTarget string
+	if info.Mode()&os.ModeSymlink != 0 {
+		linkTarget, err = os.Readlink(name)
+		if err != nil {
+			return archiver.File{}, fmt.Errorf("%s: readlink: %w", name, err)
+		}
+	}
+
+	return archiver.File{
+		FileInfo:      info,
+		NameInArchive: nameInArchive,
+		LinkTarget:    linkTarget,
+		Open: func() (io.ReadCloser, error) {
+			file, err := os.Open(name)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrorSourceRead, err)
+			}
+
+			return file, nil
+		},
+	}, nil
 }
@@ -0,0 +1,205 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/archiver/v4"
+)
+
+// ErrorUnsafePath is an error when an archive entry points outside the extraction target.
+var ErrorUnsafePath = errors.New("archive entry points outside the target directory")
+
+func (a *ArchiverAdapter) Extract(ctx context.Context, input io.Reader, target string) error {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return fmt.Errorf("resolve target: %w", err)
+	}
+
+	err = os.MkdirAll(target, 0755)
+	if err != nil {
+		return fmt.Errorf("make target dir: %w", err)
+	}
+
+	handleFile := func(ctx context.Context, file archiver.File) error {
+		err := a.extractFile(target, file)
+		if err != nil {
+			return fmt.Errorf("extract %s: %w", file.NameInArchive, err)
+		}
+
+		return nil
+	}
+
+	return a.archiver.Extract(ctx, input, nil, handleFile)
+}
+
+// Walk decodes the archive and calls handle for every entry without extracting it.
+// Content of an entry can be read only inside handle.
+func (a *ArchiverAdapter) Walk(ctx context.Context, input io.Reader, handle func(ctx context.Context, file archiver.File) error) error {
+	return a.archiver.Extract(ctx, input, nil, handle)
+}
+
+func (a *ArchiverAdapter) extractFile(target string, file archiver.File) error {
+	destination, err := EntryPath(target, file.NameInArchive)
+	if err != nil {
+		return err
+	}
+
+	if file.IsDir() {
+		return os.MkdirAll(destination, file.Mode().Perm()|0700)
+	}
+
+	err = os.MkdirAll(filepath.Dir(destination), 0755)
+	if err != nil {
+		return fmt.Errorf("make parent dir: %w", err)
+	}
+
+	// An existing file is replaced, e.g. by an incremental backup, without following a symbolic link in its place
+	err = removeFile(destination)
+	if err != nil {
+		return fmt.Errorf("replace existing file: %w", err)
+	}
+
+	if header, ok := file.Header.(*tar.Header); ok && header.Typeflag == tar.TypeLink {
+		linkTarget, err := EntryPath(target, file.LinkTarget)
+		if err != nil {
+			return err
+		}
+
+		return os.Link(linkTarget, destination)
+	}
+
+	if file.Mode()&os.ModeSymlink != 0 {
+		err = checkSymlink(target, destination, file.LinkTarget)
+		if err != nil {
+			return err
+		}
+
+		return os.Symlink(file.LinkTarget, destination)
+	}
+
+	err = a.writeFile(destination, file)
+	if err != nil {
+		return err
+	}
+
+	// Modification time is restored on a best effort basis, not every format stores it
+	_ = os.Chtimes(destination, file.ModTime(), file.ModTime())
+
+	return nil
+}
+
+func (a *ArchiverAdapter) writeFile(destination string, file archiver.File) error {
+	source, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("open entry: %w", err)
+	}
+	defer source.Close()
+
+	output, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, file.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer output.Close()
+
+	_, err = io.Copy(output, source)
+	if err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+
+	return output.Close()
+}
+
+// removeFile removes the file if it exists and it is not a directory.
+func removeFile(name string) error {
+	info, err := os.Lstat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return nil
+	}
+
+	return os.Remove(name)
+}
+
+// EntryPath joins the name from archive with target and makes sure it does not escape the target.
+// Directories of the target are written and read through, so none of its existing parents may be a symbolic link.
+func EntryPath(target string, nameInArchive string) (string, error) {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return "", fmt.Errorf("resolve target: %w", err)
+	}
+
+	destination := filepath.Join(target, filepath.FromSlash(nameInArchive))
+
+	if !withinTarget(target, destination) {
+		return "", fmt.Errorf("%s: %w", nameInArchive, ErrorUnsafePath)
+	}
+
+	err = checkParents(target, destination)
+	if err != nil {
+		return "", err
+	}
+
+	return destination, nil
+}
+
+// checkSymlink makes sure the symbolic link at destination points inside the target.
+// Absolute links are rejected, even into the target, because the target may be restored to another place.
+func checkSymlink(target string, destination string, linkTarget string) error {
+	name := filepath.FromSlash(linkTarget)
+
+	if filepath.IsAbs(name) || !withinTarget(target, filepath.Join(filepath.Dir(destination), name)) {
+		return fmt.Errorf("symbolic link to %s: %w", linkTarget, ErrorUnsafePath)
+	}
+
+	return nil
+}
+
+// checkParents makes sure no existing parent of destination inside the target is a symbolic link,
+// so nothing is written outside the target through a link extracted before.
+func checkParents(target string, destination string) error {
+	relativePath, err := filepath.Rel(target, filepath.Dir(destination))
+	if err != nil {
+		return fmt.Errorf("resolve parent dir: %w", err)
+	}
+
+	if destination == target || relativePath == "." {
+		return nil
+	}
+
+	parent := target
+	for _, name := range strings.Split(relativePath, string(filepath.Separator)) {
+		parent = filepath.Join(parent, name)
+
+		info, err := os.Lstat(parent)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("check parent dir: %w", err)
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("parent %s is a symbolic link: %w", parent, ErrorUnsafePath)
+		}
+	}
+
+	return nil
+}
+
+// withinTarget reports whether the path is the target or inside it.
+func withinTarget(target string, path string) bool {
+	return path == target || strings.HasPrefix(path, target+string(filepath.Separator))
+}
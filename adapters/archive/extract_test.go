@@ -0,0 +1,56 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEntryPath(t *testing.T) {
+	target := t.TempDir()
+
+	err := os.Symlink(os.TempDir(), filepath.Join(target, "link"))
+	if err != nil {
+		t.Fatalf("make symbolic link: %v", err)
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("get working dir: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		target        string
+		nameInArchive string
+		want          string
+		wantErr       error
+	}{
+		{name: "file", nameInArchive: "dir/file", want: filepath.Join(target, "dir", "file")},
+		{name: "root", nameInArchive: ".", want: target},
+		{name: "relative target", target: ".", nameInArchive: "file", want: filepath.Join(workDir, "file")},
+		{name: "parent", nameInArchive: "../file", wantErr: ErrorUnsafePath},
+		{name: "parent in the middle", nameInArchive: "dir/../../file", wantErr: ErrorUnsafePath},
+		{name: "under symbolic link", nameInArchive: "link/file", wantErr: ErrorUnsafePath},
+		{name: "symbolic link itself", nameInArchive: "link", want: filepath.Join(target, "link")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entryTarget := tt.target
+			if entryTarget == "" {
+				entryTarget = target + string(filepath.Separator)
+			}
+
+			got, err := EntryPath(entryTarget, tt.nameInArchive)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("path = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
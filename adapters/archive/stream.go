@@ -0,0 +1,234 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/FirinKinuo/capyback/pipe"
+
+	"github.com/mholt/archiver/v4"
+)
+
+// ErrorNotSingleFile is an error when files are archived in a compression format, which holds only one file.
+var ErrorNotSingleFile = errors.New("compression format holds a single regular file, use an archive format like tar.zst")
+
+// streamSpoolFilePattern is a pattern of names of files, which streams are spooled into.
+const streamSpoolFilePattern = ".capyback-stream-*"
+
+// ArchiveStream archives the stream as a single file named name.
+// Size of an archive entry is written before its content, so the stream is spooled into a temporary file first.
+// The spool file is created in the spool directory and fails with pipe.ErrorSpoolFull over the spool max size.
+func (a *ArchiverAdapter) ArchiveStream(ctx context.Context, output io.Writer, input io.Reader, name string) error {
+	spool, err := os.CreateTemp(a.spoolDirectory, streamSpoolFilePattern)
+	if err != nil {
+		return fmt.Errorf("create spool file: %w", err)
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+
+	if a.progress != nil {
+		a.progress.StartFile(name)
+		input = &progressReadCloser{ReadCloser: io.NopCloser(input), tracker: a.progress}
+	}
+
+	spoolWriter := &spoolWriter{file: spool, maxSize: a.spoolMaxSize}
+
+	size, err := io.Copy(spoolWriter, input)
+	if spoolWriter.err != nil {
+		return fmt.Errorf("spool stream: %w", spoolWriter.err)
+	}
+	if err != nil {
+		return fmt.Errorf("spool stream: %w: %w", ErrorSourceRead, err)
+	}
+
+	_, err = spool.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("rewind spool file: %w", err)
+	}
+
+	file := archiver.File{
+		FileInfo:      streamFileInfo{name: path.Base(name), size: size, modTime: time.Now()},
+		NameInArchive: name,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(spool), nil
+		},
+	}
+
+	return a.archiver.Archive(ctx, output, []archiver.File{file})
+}
+
+// spoolWriter writes to the spool file, until the size of the file exceeds the max size.
+// It keeps its error, so errors of the spool are told apart from errors of reading the stream.
+type spoolWriter struct {
+	file    *os.File
+	maxSize int64
+	written int64
+	err     error
+}
+
+func (w *spoolWriter) Write(p []byte) (int, error) {
+	if w.maxSize > 0 && w.written+int64(len(p)) > w.maxSize {
+		w.err = fmt.Errorf(
+			"%w: %d bytes, a compression format without an archive, like zst, compresses a stream without a spool",
+			pipe.ErrorSpoolFull,
+			w.maxSize,
+		)
+		return 0, w.err
+	}
+
+	n, err := w.file.Write(p)
+	w.written += int64(n)
+	if err != nil {
+		w.err = fmt.Errorf("write spool file: %w", err)
+	}
+
+	return n, w.err
+}
+
+// CompressorAdapter stores a single file or stream compressed, without an archive around it.
+type CompressorAdapter struct {
+	compression archiver.Compression
+	// name is the name of the file, which is restored from the compressed stream.
+	name string
+}
+
+func NewCompressorAdapter(compression archiver.Compression, name string) *CompressorAdapter {
+	return &CompressorAdapter{compression: compression, name: name}
+}
+
+func (c *CompressorAdapter) Format() string {
+	return formatName(c.compression.Name())
+}
+
+// Archive compresses the only file, it fails with ErrorNotSingleFile for directories and several files.
+func (c *CompressorAdapter) Archive(ctx context.Context, output io.Writer, files []string) error {
+	_, err := c.Scan(ctx, files)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(files[0])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorSourceRead, err)
+	}
+	defer file.Close()
+
+	return c.ArchiveStream(ctx, output, file, "")
+}
+
+// Scan checks that files are a single regular file and returns its size.
+func (c *CompressorAdapter) Scan(_ context.Context, files []string) (Summary, error) {
+	if len(files) != 1 {
+		return Summary{}, ErrorNotSingleFile
+	}
+
+	info, err := os.Stat(files[0])
+	if err != nil {
+		return Summary{}, fmt.Errorf("%w: %w", ErrorSourceRead, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return Summary{}, fmt.Errorf("%s: %w", files[0], ErrorNotSingleFile)
+	}
+
+	return Summary{Entries: 1, Files: 1, Size: info.Size()}, nil
+}
+
+// ArchiveStream compresses the stream, the name is not stored.
+func (c *CompressorAdapter) ArchiveStream(_ context.Context, output io.Writer, input io.Reader, _ string) error {
+	compressor, err := c.compression.OpenWriter(output)
+	if err != nil {
+		return fmt.Errorf("open compressor: %w", err)
+	}
+
+	_, err = io.Copy(compressor, input)
+	if err != nil {
+		_ = compressor.Close()
+		return fmt.Errorf("compress: %w", err)
+	}
+
+	return compressor.Close()
+}
+
+// Extract decompresses the stream into the file named after the backup in the target directory.
+func (c *CompressorAdapter) Extract(_ context.Context, input io.Reader, target string) error {
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		return fmt.Errorf("make target dir: %w", err)
+	}
+
+	destination := filepath.Join(target, c.name)
+
+	err = removeFile(destination)
+	if err != nil {
+		return fmt.Errorf("replace existing file: %w", err)
+	}
+
+	decompressor, err := c.compression.OpenReader(input)
+	if err != nil {
+		return fmt.Errorf("open decompressor: %w", err)
+	}
+	defer decompressor.Close()
+
+	output, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer output.Close()
+
+	_, err = io.Copy(output, decompressor)
+	if err != nil {
+		return fmt.Errorf("extract %s: %w", c.name, err)
+	}
+
+	return output.Close()
+}
+
+// Walk calls handle for the only file of the stream, its size is unknown until it is read.
+func (c *CompressorAdapter) Walk(ctx context.Context, input io.Reader, handle func(ctx context.Context, file archiver.File) error) error {
+	decompressor, err := c.compression.OpenReader(input)
+	if err != nil {
+		return fmt.Errorf("open decompressor: %w", err)
+	}
+	defer decompressor.Close()
+
+	return handle(ctx, archiver.File{
+		FileInfo:      streamFileInfo{name: c.name, size: -1},
+		NameInArchive: c.name,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(decompressor), nil
+		},
+	})
+}
+
+// streamFileInfo describes a file, which is a stream and not a file on disk.
+type streamFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i streamFileInfo) Name() string       { return i.name }
+func (i streamFileInfo) Size() int64        { return i.size }
+func (i streamFileInfo) Mode() fs.FileMode  { return 0644 }
+func (i streamFileInfo) ModTime() time.Time { return i.modTime }
+func (i streamFileInfo) IsDir() bool        { return false }
+func (i streamFileInfo) Sys() any           { return nil }
+
+// formatName returns the format name without the leading dot of the extension.
+func formatName(extension string) string {
+	if len(extension) > 1 {
+		return extension[1:]
+	}
+
+	return extension
+}
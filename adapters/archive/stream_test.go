@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FirinKinuo/capyback/pipe"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func TestArchiverAdapterArchiveStream(t *testing.T) {
+	content := strings.Repeat("dump line\n", 100)
+
+	tests := []struct {
+		name         string
+		spoolMaxSize int64
+		spoolMissing bool
+		wantErr      error
+	}{
+		{name: "no limit"},
+		{name: "under limit", spoolMaxSize: int64(len(content))},
+		{name: "over limit", spoolMaxSize: int64(len(content)) - 1, wantErr: pipe.ErrorSpoolFull},
+		{name: "missing spool directory", spoolMissing: true, wantErr: fs.ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spoolDirectory := t.TempDir()
+			if tt.spoolMissing {
+				spoolDirectory = filepath.Join(spoolDirectory, "missing")
+			}
+
+			adapter := NewArchiverAdapter(archiver.Tar{}, WithSpool(spoolDirectory, tt.spoolMaxSize))
+
+			var output bytes.Buffer
+			err := adapter.ArchiveStream(context.Background(), &output, strings.NewReader(content), "dump.sql")
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("archive stream = %v, want %v", err, tt.wantErr)
+				}
+
+				if errors.Is(err, ErrorSourceRead) {
+					t.Errorf("archive stream = %v, want an error not of %v", err, ErrorSourceRead)
+				}
+			case err != nil:
+				t.Fatalf("archive stream: %v", err)
+			default:
+				if got := readTarFile(t, &output, "dump.sql"); got != content {
+					t.Errorf("archived %d bytes, want %d bytes of the stream", len(got), len(content))
+				}
+			}
+
+			if !tt.spoolMissing {
+				entries, err := os.ReadDir(spoolDirectory)
+				if err != nil {
+					t.Fatalf("read spool directory: %v", err)
+				}
+
+				if len(entries) != 0 {
+					t.Errorf("spool directory has %d files left, want none", len(entries))
+				}
+			}
+		})
+	}
+}
+
+// readTarFile returns content of the file in the tar archive.
+func readTarFile(t *testing.T, input io.Reader, name string) string {
+	t.Helper()
+
+	var content []byte
+
+	err := archiver.Tar{}.Extract(context.Background(), input, []string{name}, func(_ context.Context, file archiver.File) error {
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		content, err = io.ReadAll(reader)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("extract %s: %v", name, err)
+	}
+
+	return string(content)
+}
@@ -2,18 +2,31 @@ package application
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/FirinKinuo/capyback/archive"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/hook"
 	"github.com/FirinKinuo/capyback/pipe"
+	"github.com/FirinKinuo/capyback/progress"
 	"github.com/FirinKinuo/capyback/storage"
 	"github.com/charmbracelet/log"
+	"io"
+	"strconv"
+	"time"
 )
 
+// ErrorHook is an error when a hook of the backup failed.
+var ErrorHook = errors.New("hook failed")
+
 // Backup is the application that creates a backup of the files and writes it to the storage.
 type Backup struct {
-	pipe     pipe.Piper
-	storage  storage.Storager
-	archiver archive.Archiver
+	pipe      pipe.Piper
+	storage   storage.Storager
+	archiver  archive.Archiver
+	encrypter crypt.Encrypter
+	hooks     *hook.Runner
+	progress  *progress.Tracker
 }
 
 // NewBackup constructs a new Backup application.
@@ -25,36 +38,216 @@ func NewBackup(p pipe.Piper, s storage.Storager, a archive.Archiver) *Backup {
 	}
 }
 
+// SetEncrypter enables encryption of the archive before it is written to the storage.
+func (t *Backup) SetEncrypter(e crypt.Encrypter) {
+	t.encrypter = e
+}
+
+// SetHooks enables hooks, which are run before and after the backup.
+func (t *Backup) SetHooks(h *hook.Runner) {
+	t.hooks = h
+}
+
+// SetProgress enables counting of data going through the pipe, the tracker is shared with the archiver.
+func (t *Backup) SetProgress(tracker *progress.Tracker) {
+	t.progress = tracker
+	t.pipe = pipe.NewCountingPipe(t.pipe, tracker)
+}
+
+// BackupResult describes the written backup, SHA256 is a hex checksum of the content as it is stored.
+type BackupResult struct {
+	Name   string
+	Format string
+	Size   int64
+	SHA256 string
+	// Files is the number of archived files, it is counted only with progress.
+	Files int64
+	// Duration is the time of archiving and writing to the storage, hooks are not included.
+	Duration time.Duration
+}
+
+// Stream opens content of a streamed backup, like stdin or output of a command.
+// The stream is closed when it is archived, an error of Close fails the backup, e.g. when the command failed.
+type Stream func(ctx context.Context) (io.ReadCloser, error)
+
+// archiveFunc writes an archive to out.
+type archiveFunc func(ctx context.Context, out io.Writer) error
+
 // Save creates a backup of the files and writes it to the storage.
-func (t *Backup) Save(ctx context.Context, files []string, writeParams storage.WriteParams) error {
+// The content is hashed while it is uploaded, the storage verifies the upload with the checksum and stores it.
+// With hooks, before hooks are run first, after hooks and hooks of the result are run even if the backup failed.
+func (t *Backup) Save(ctx context.Context, files []string, writeParams storage.WriteParams) (*BackupResult, error) {
+	return t.saveWithHooks(ctx, func(ctx context.Context, out io.Writer) error {
+		return t.archiver.Archive(ctx, out, files)
+	}, writeParams)
+}
+
+// SaveStream creates a backup of the stream, archived as a file named name, and writes it to the storage.
+// The stream is opened after before hooks, so they can prepare what it reads.
+func (t *Backup) SaveStream(ctx context.Context, stream Stream, name string, writeParams storage.WriteParams) (*BackupResult, error) {
+	return t.saveWithHooks(ctx, func(ctx context.Context, out io.Writer) error {
+		content, err := stream(ctx)
+		if err != nil {
+			return fmt.Errorf("open stream: %w: %w", archive.ErrorSourceRead, err)
+		}
+
+		err = t.archiver.ArchiveStream(ctx, out, content, name)
+
+		closeErr := content.Close()
+		if closeErr != nil {
+			closeErr = fmt.Errorf("%w: %w", archive.ErrorSourceRead, closeErr)
+		}
+
+		return errors.Join(err, closeErr)
+	}, writeParams)
+}
+
+// saveWithHooks writes the archive to the storage, running hooks around it.
+func (t *Backup) saveWithHooks(ctx context.Context, archive archiveFunc, writeParams storage.WriteParams) (*BackupResult, error) {
+	if t.hooks == nil {
+		return t.save(ctx, archive, writeParams)
+	}
+
+	env := map[string]string{hook.EnvBackupName: writeParams.Name()}
+
+	var result *BackupResult
+
+	err := t.hooks.Run(ctx, hook.Before, env)
+	if err != nil {
+		err = fmt.Errorf("run hooks: %w: %w", ErrorHook, err)
+	} else {
+		result, err = t.save(ctx, archive, writeParams)
+	}
+
+	// Hooks after the backup release what before hooks have taken, so they are run even if the backup is cancelled
+	hookCtx := context.WithoutCancel(ctx)
+
+	afterErr := t.hooks.Run(hookCtx, hook.After, resultEnv(env, result, err))
+	if afterErr != nil {
+		err = errors.Join(err, fmt.Errorf("%w: %w", ErrorHook, afterErr))
+	}
+
+	resultStage := hook.OnSuccess
+	if err != nil {
+		resultStage = hook.OnFailure
+	}
+
+	resultErr := t.hooks.Run(hookCtx, resultStage, resultEnv(env, result, err))
+	if resultErr != nil {
+		err = errors.Join(err, fmt.Errorf("%w: %w", ErrorHook, resultErr))
+	}
+
+	return result, err
+}
+
+// resultEnv returns environment of hooks after the backup, which describes the result of the backup.
+func resultEnv(env map[string]string, result *BackupResult, err error) map[string]string {
+	resultEnv := map[string]string{hook.EnvStatus: hook.StatusSuccess}
+	for key, value := range env {
+		resultEnv[key] = value
+	}
+
+	if result != nil {
+		resultEnv[hook.EnvObjectSize] = strconv.FormatInt(result.Size, 10)
+		resultEnv[hook.EnvSha256] = result.SHA256
+	}
+
+	if err != nil {
+		resultEnv[hook.EnvStatus] = hook.StatusFailure
+		resultEnv[hook.EnvError] = err.Error()
+	}
+
+	return resultEnv
+}
+
+// save archives and writes the archive to the storage.
+func (t *Backup) save(ctx context.Context, archive archiveFunc, writeParams storage.WriteParams) (*BackupResult, error) {
+	started := time.Now()
+
 	log.Info("Archiving", "format", t.archiver.Format())
 
-	go t.archive(ctx, files)
+	archiveResult := make(chan error, 1)
+	go t.archive(ctx, archive, archiveResult)
 
 	log.Info("Attempting to authenticate to storage")
 	err := t.storage.Authenticate(ctx)
 	if err != nil {
-		return fmt.Errorf("authenticate storage: %w", err)
+		return nil, fmt.Errorf("authenticate storage: %w", err)
 	}
 
 	log.Info("Authentication to storage succeeded.")
 
+	checksum := storage.NewChecksum(t.pipe)
+	writeParams.SetChecksum(checksum)
+
 	log.Info("Writing to storage")
-	err = t.storage.Write(ctx, t.pipe, writeParams)
+	err = t.storage.Write(ctx, checksum, writeParams)
 	if err != nil {
-		return fmt.Errorf("write to storage: %w", err)
+		// The write fails, when the archive fails, then the error of the archive is the cause
+		select {
+		case archiveErr := <-archiveResult:
+			if archiveErr != nil {
+				return nil, archiveErr
+			}
+		default:
+		}
+
+		return nil, fmt.Errorf("write to storage: %w", err)
 	}
 
-	log.Info("Writing to storage completed successfully")
-	return nil
+	log.Info("Writing to storage completed successfully", "sha256", checksum.SHA256())
+	result := &BackupResult{
+		Name:     writeParams.Name(),
+		Format:   t.archiver.Format(),
+		Size:     checksum.Size(),
+		SHA256:   checksum.SHA256(),
+		Duration: time.Since(started),
+	}
+
+	if t.progress != nil {
+		result.Files = t.progress.Stats().Files
+	}
+
+	return result, nil
 }
 
-// archive creates an archive of the files and writes it to the pipe.
-func (t *Backup) archive(ctx context.Context, files []string) {
-	err := t.archiver.Archive(ctx, t.pipe, files)
+// archive creates an archive and writes it to the pipe.
+// The result is sent before the pipe is closed, so it is known when the storage fails with the pipe.
+func (t *Backup) archive(ctx context.Context, archive archiveFunc, result chan<- error) {
+	err := t.writeArchive(ctx, archive)
 	if err != nil {
-		t.pipe.CloseWriteWithErr(fmt.Errorf("archive: %w", err))
+		err = fmt.Errorf("archive: %w", err)
+	}
+
+	result <- err
+
+	if err != nil {
+		t.pipe.CloseWriteWithErr(err)
 	}
 
 	t.pipe.CloseWrite()
 }
+
+// writeArchive writes the archive to the pipe, encrypting it if an encrypter is set.
+func (t *Backup) writeArchive(ctx context.Context, archive archiveFunc) error {
+	if t.encrypter == nil {
+		return archive(ctx, t.pipe)
+	}
+
+	encryptedPipe, err := t.encrypter.Encrypt(t.pipe)
+	if err != nil {
+		return fmt.Errorf("start encryption: %w", err)
+	}
+
+	err = archive(ctx, encryptedPipe)
+	if err != nil {
+		return err
+	}
+
+	err = encryptedPipe.Close()
+	if err != nil {
+		return fmt.Errorf("finish encryption: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/index"
+	"github.com/FirinKinuo/capyback/storage"
+	"github.com/charmbracelet/log"
+)
+
+// ErrorEncryptedIndex is an error when an encrypted index is read without a decrypter.
+var ErrorEncryptedIndex = errors.New("index is encrypted, an identity or a passphrase is required")
+
+// Indexes reads and writes indexes of incremental backups in the storage.
+// An index is stored next to its backup and is encrypted when the backup is encrypted.
+// The storage must be already authenticated.
+type Indexes struct {
+	storage   storage.Storager
+	encrypter crypt.Encrypter
+	decrypter crypt.Decrypter
+}
+
+// NewIndexes constructs a new Indexes application.
+func NewIndexes(s storage.Storager) *Indexes {
+	return &Indexes{storage: s}
+}
+
+// SetEncrypter enables encryption of written indexes.
+func (i *Indexes) SetEncrypter(e crypt.Encrypter) {
+	i.encrypter = e
+}
+
+// SetDecrypter enables reading of encrypted indexes.
+func (i *Indexes) SetDecrypter(d crypt.Decrypter) {
+	i.decrypter = d
+}
+
+// IndexName returns the name of the index of the backup.
+func IndexName(backupName string) string {
+	if crypt.IsEncrypted(backupName) {
+		return index.Name(crypt.TrimSuffix(backupName)) + crypt.Suffix
+	}
+
+	return index.Name(backupName)
+}
+
+// Write writes the index of the backup.
+func (i *Indexes) Write(ctx context.Context, backupIndex *index.Index, writeParams storage.WriteParams) error {
+	var content bytes.Buffer
+	var out io.WriteCloser = nopWriteCloser{Writer: &content}
+
+	if i.encrypter != nil {
+		var err error
+		out, err = i.encrypter.Encrypt(&content)
+		if err != nil {
+			return fmt.Errorf("start encryption: %w", err)
+		}
+	}
+
+	err := backupIndex.Write(out)
+	if err != nil {
+		return err
+	}
+
+	err = out.Close()
+	if err != nil {
+		return fmt.Errorf("finish encryption: %w", err)
+	}
+
+	checksum := storage.NewContentChecksum(content.Bytes())
+	writeParams.SetName(IndexName(backupIndex.Backup))
+	writeParams.SetChecksum(checksum)
+	writeParams.SetSize(int64(content.Len()))
+
+	err = i.storage.Write(ctx, checksum, writeParams)
+	if err != nil {
+		return fmt.Errorf("write index: %w", err)
+	}
+
+	return nil
+}
+
+// Read reads the index of the object.
+func (i *Indexes) Read(ctx context.Context, objectParams storage.ObjectParams, name string) (*index.Index, error) {
+	if crypt.IsEncrypted(name) && i.decrypter == nil {
+		return nil, fmt.Errorf("%s: %w", name, ErrorEncryptedIndex)
+	}
+
+	var content bytes.Buffer
+
+	objectParams.SetName(name)
+
+	err := i.storage.Read(ctx, &content, objectParams)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+
+	var in io.Reader = &content
+	if crypt.IsEncrypted(name) {
+		in, err = i.decrypter.Decrypt(in)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s: %w", name, err)
+		}
+	}
+
+	backupIndex, err := index.Read(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return backupIndex, nil
+}
+
+// Latest returns the index of the newest backup of the series, or nil if there is none.
+func (i *Indexes) Latest(
+	ctx context.Context,
+	listParams storage.ListParams,
+	objectParams storage.ObjectParams,
+	series string,
+) (*index.Index, error) {
+	objects, err := i.storage.List(ctx, listParams)
+	if err != nil {
+		return nil, fmt.Errorf("list storage: %w", err)
+	}
+
+	indexes := make([]storage.Object, 0, len(objects))
+	for _, object := range objects {
+		if index.IsIndex(object.Name) {
+			indexes = append(indexes, object)
+		}
+	}
+
+	sort.Slice(indexes, func(a, b int) bool {
+		return indexes[a].LastModified.After(indexes[b].LastModified)
+	})
+
+	for _, object := range indexes {
+		backupIndex, err := i.Read(ctx, objectParams, object.Name)
+		if errors.Is(err, ErrorEncryptedIndex) {
+			log.Debug("Skip encrypted index", "name", object.Name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if backupIndex.Series == series {
+			return backupIndex, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Chain returns indexes of the backup and its parents from the full backup to the backup itself,
+// or nil if the backup has no index.
+func (i *Indexes) Chain(
+	ctx context.Context,
+	objectParams storage.ObjectParams,
+	backupName string,
+) ([]*index.Index, error) {
+	exists, err := i.exists(ctx, objectParams, IndexName(backupName))
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	var chain []*index.Index
+	seen := make(map[string]bool)
+
+	for name := backupName; name != ""; {
+		if seen[name] {
+			return nil, fmt.Errorf("backup %s is its own parent", name)
+		}
+		seen[name] = true
+
+		backupIndex, err := i.Read(ctx, objectParams, IndexName(name))
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append([]*index.Index{backupIndex}, chain...)
+		name = backupIndex.Parent
+	}
+
+	return chain, nil
+}
+
+// exists reports whether the object exists in the storage.
+func (i *Indexes) exists(ctx context.Context, objectParams storage.ObjectParams, name string) (bool, error) {
+	objectParams.SetName(name)
+
+	_, err := i.storage.Stat(ctx, objectParams)
+	if errors.Is(err, storage.ErrorObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("stat storage: %w", err)
+	}
+
+	return true, nil
+}
+
+// nopWriteCloser is a writer with Close that does nothing, it takes place of an encrypting writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
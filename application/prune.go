@@ -0,0 +1,154 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/FirinKinuo/capyback/index"
+	"github.com/FirinKinuo/capyback/retention"
+	"github.com/FirinKinuo/capyback/storage"
+	"github.com/charmbracelet/log"
+)
+
+// Prune is the application that removes backups from the storage according to retention policies.
+type Prune struct {
+	storage  storage.Storager
+	policies []retention.Policy
+	indexes  *Indexes
+}
+
+// NewPrune constructs a new Prune application.
+func NewPrune(s storage.Storager, policies []retention.Policy) *Prune {
+	return &Prune{
+		storage:  s,
+		policies: policies,
+	}
+}
+
+// SetIndexes keeps parents of kept incremental backups, so their chains can be restored.
+// Without indexes, backups are pruned as independent ones.
+func (p *Prune) SetIndexes(i *Indexes) {
+	p.indexes = i
+}
+
+// Prune removes backups not kept by retention policies and returns them.
+// The storage must be already authenticated.
+// When dryRun is set, nothing is removed.
+func (p *Prune) Prune(
+	ctx context.Context,
+	listParams storage.ListParams,
+	objectParams storage.ObjectParams,
+	dryRun bool,
+) ([]storage.Object, error) {
+	objects, err := p.storage.List(ctx, listParams)
+	if err != nil {
+		return nil, fmt.Errorf("list storage: %w", err)
+	}
+
+	// Indexes are not backups, they are removed together with their backups
+	backups := make([]storage.Object, 0, len(objects))
+	indexNames := make(map[string]bool)
+
+	for _, object := range objects {
+		if index.IsIndex(object.Name) {
+			indexNames[object.Name] = true
+			continue
+		}
+
+		backups = append(backups, object)
+	}
+
+	keep, remove := retention.Apply(p.policies, backups, time.Now())
+
+	if p.indexes != nil {
+		keep, remove, err = p.keepChains(ctx, objectParams, indexNames, keep, remove)
+		if err != nil {
+			return nil, fmt.Errorf("keep incremental chains: %w", err)
+		}
+	}
+
+	sort.Slice(remove, func(i, j int) bool {
+		return remove[i].Name < remove[j].Name
+	})
+
+	log.Info("Retention policies applied", "keep", len(keep), "remove", len(remove))
+
+	for _, object := range remove {
+		if dryRun {
+			log.Info("Would remove", "name", object.Name)
+			continue
+		}
+
+		log.Info("Removing", "name", object.Name)
+
+		objectParams.SetName(object.Name)
+		err = p.storage.Delete(ctx, objectParams)
+		if err != nil {
+			return nil, fmt.Errorf("delete %s: %w", object.Name, err)
+		}
+
+		if indexName := IndexName(object.Name); indexNames[indexName] {
+			objectParams.SetName(indexName)
+			err = p.storage.Delete(ctx, objectParams)
+			if err != nil {
+				return nil, fmt.Errorf("delete %s: %w", indexName, err)
+			}
+		}
+	}
+
+	return remove, nil
+}
+
+// keepChains moves parents of kept incremental backups from removed to kept backups.
+func (p *Prune) keepChains(
+	ctx context.Context,
+	objectParams storage.ObjectParams,
+	indexNames map[string]bool,
+	keep []storage.Object,
+	remove []storage.Object,
+) ([]storage.Object, []storage.Object, error) {
+	removed := make(map[string]storage.Object, len(remove))
+	for _, object := range remove {
+		removed[object.Name] = object
+	}
+
+	visited := make(map[string]bool)
+	pending := make([]string, 0, len(keep))
+	for _, object := range keep {
+		pending = append(pending, object.Name)
+	}
+
+	for len(pending) > 0 {
+		name := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if visited[name] || !indexNames[IndexName(name)] {
+			continue
+		}
+		visited[name] = true
+
+		backupIndex, err := p.indexes.Read(ctx, objectParams, IndexName(name))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if parent, ok := removed[backupIndex.Parent]; ok {
+			log.Info("Keep parent of incremental backup", "name", parent.Name, "child", name)
+			delete(removed, parent.Name)
+			keep = append(keep, parent)
+		}
+
+		if backupIndex.Parent != "" {
+			pending = append(pending, backupIndex.Parent)
+		}
+	}
+
+	remove = remove[:0]
+	for _, object := range removed {
+		remove = append(remove, object)
+	}
+
+	return keep, remove, nil
+}
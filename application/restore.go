@@ -0,0 +1,102 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"github.com/FirinKinuo/capyback/archive"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/pipe"
+	"github.com/FirinKinuo/capyback/storage"
+	"github.com/charmbracelet/log"
+	"io"
+)
+
+// Restore is the application that reads a backup from the storage and extracts it.
+type Restore struct {
+	pipe      pipe.Piper
+	storage   storage.Storager
+	archiver  archive.Archiver
+	decrypter crypt.Decrypter
+}
+
+// NewRestore constructs a new Restore application.
+func NewRestore(p pipe.Piper, s storage.Storager, a archive.Archiver) *Restore {
+	return &Restore{
+		pipe:     p,
+		storage:  s,
+		archiver: a,
+	}
+}
+
+// SetDecrypter enables decryption of the backup before it is extracted.
+func (r *Restore) SetDecrypter(d crypt.Decrypter) {
+	r.decrypter = d
+}
+
+// Restore reads a backup from the storage and extracts it into the target directory.
+func (r *Restore) Restore(ctx context.Context, objectParams storage.ObjectParams, target string) error {
+	log.Info("Attempting to authenticate to storage")
+	err := r.storage.Authenticate(ctx)
+	if err != nil {
+		return fmt.Errorf("authenticate storage: %w", err)
+	}
+
+	log.Info("Authentication to storage succeeded.")
+
+	readResult := make(chan error, 1)
+
+	go func() {
+		readResult <- r.read(ctx, objectParams)
+	}()
+
+	archiveReader, err := r.archiveReader()
+	if err != nil {
+		r.pipe.CloseReadWithErr(err)
+		return fmt.Errorf("decrypt: %w", err)
+	}
+
+	log.Info("Extracting", "format", r.archiver.Format(), "target", target)
+	err = r.archiver.Extract(ctx, archiveReader, target)
+	if err != nil {
+		r.pipe.CloseReadWithErr(err)
+		return fmt.Errorf("extract: %w", err)
+	}
+
+	// The archive may end before the stored content, the rest is read, so errors of the storage are not missed
+	_, err = io.Copy(io.Discard, r.pipe)
+	if err != nil {
+		return fmt.Errorf("read rest of backup: %w", err)
+	}
+
+	err = <-readResult
+	if err != nil {
+		return err
+	}
+
+	log.Info("Extracting completed successfully")
+	return nil
+}
+
+// archiveReader returns a reader of the archive from the pipe, decrypting it if a decrypter is set.
+func (r *Restore) archiveReader() (io.Reader, error) {
+	if r.decrypter == nil {
+		return r.pipe, nil
+	}
+
+	return r.decrypter.Decrypt(r.pipe)
+}
+
+// read reads the backup from the storage and writes it to the pipe.
+func (r *Restore) read(ctx context.Context, objectParams storage.ObjectParams) error {
+	err := r.storage.Read(ctx, r.pipe, objectParams)
+	if err != nil {
+		err = fmt.Errorf("read from storage: %w", err)
+		r.pipe.CloseWriteWithErr(err)
+
+		return err
+	}
+
+	r.pipe.CloseWrite()
+
+	return nil
+}
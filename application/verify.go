@@ -0,0 +1,296 @@
+package application
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/FirinKinuo/capyback/archive"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/pipe"
+	"github.com/FirinKinuo/capyback/storage"
+	"github.com/charmbracelet/log"
+)
+
+// ErrorChecksumMismatch is an error when the backup content does not match the checksum stored with it.
+var ErrorChecksumMismatch = errors.New("backup content does not match the stored checksum")
+
+// Reasons of mismatches between the backup and the source tree.
+const (
+	MismatchMissing = "missing in source"
+	MismatchType    = "file type differs"
+	MismatchSize    = "size differs"
+	MismatchContent = "content differs"
+	MismatchLink    = "link target differs"
+)
+
+// Mismatch is a difference between an archive entry and the file of the source tree.
+type Mismatch struct {
+	Path   string
+	Reason string
+}
+
+// VerifyReport describes a verified backup.
+type VerifyReport struct {
+	// Checksum is a hex sha256 of the stored backup, Checked is set when it matched the stored checksum.
+	Checksum string
+	Checked  bool
+
+	Entries int
+	Bytes   int64
+
+	Mismatches []Mismatch
+}
+
+// Verify is the application that reads a backup from the storage and decodes every entry of its archive.
+// With a source tree, content of the entries is compared with files of the tree.
+type Verify struct {
+	pipe      pipe.Piper
+	storage   storage.Storager
+	archiver  archive.Archiver
+	decrypter crypt.Decrypter
+	source    string
+}
+
+// NewVerify constructs a new Verify application.
+func NewVerify(p pipe.Piper, s storage.Storager, a archive.Archiver) *Verify {
+	return &Verify{
+		pipe:     p,
+		storage:  s,
+		archiver: a,
+	}
+}
+
+// SetDecrypter enables decryption of the backup before it is decoded.
+func (v *Verify) SetDecrypter(d crypt.Decrypter) {
+	v.decrypter = d
+}
+
+// SetSource enables comparison of entries with files of the source directory,
+// an entry is compared with the file it would be restored to, if the directory was the restore target.
+func (v *Verify) SetSource(directory string) {
+	v.source = directory
+}
+
+// Verify reads the backup, checks it against the stored checksum, if there is one, and decodes the archive.
+// The storage must be already authenticated.
+func (v *Verify) Verify(ctx context.Context, objectParams storage.ObjectParams) (*VerifyReport, error) {
+	object, err := v.storage.Stat(ctx, objectParams)
+	if err != nil {
+		return nil, fmt.Errorf("stat backup: %w", err)
+	}
+
+	contentHash := sha256.New()
+	readResult := make(chan error, 1)
+
+	go func() {
+		readResult <- v.read(ctx, objectParams, contentHash)
+	}()
+
+	report := &VerifyReport{}
+
+	archiveReader, err := v.archiveReader()
+	if err != nil {
+		v.pipe.CloseReadWithErr(err)
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	log.Info("Verifying", "format", v.archiver.Format())
+	err = v.archiver.Walk(ctx, archiveReader, func(ctx context.Context, file archive.File) error {
+		err := v.verifyFile(report, file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.NameInArchive, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		v.pipe.CloseReadWithErr(err)
+		return nil, fmt.Errorf("decode archive: %w", err)
+	}
+
+	// The archive may end before the stored content, the rest is read to complete the checksum
+	_, err = io.Copy(io.Discard, v.pipe)
+	if err != nil {
+		return nil, fmt.Errorf("read rest of backup: %w", err)
+	}
+
+	err = <-readResult
+	if err != nil {
+		return nil, err
+	}
+
+	report.Checksum = hex.EncodeToString(contentHash.Sum(nil))
+
+	storedChecksum := object.Metadata[storage.MetadataSha256]
+	if storedChecksum == "" {
+		log.Warn("Backup has no stored checksum, only the archive is verified")
+		return report, nil
+	}
+
+	if storedChecksum != report.Checksum {
+		return report, fmt.Errorf("%w: stored %s, read %s", ErrorChecksumMismatch, storedChecksum, report.Checksum)
+	}
+
+	report.Checked = true
+
+	return report, nil
+}
+
+// archiveReader returns a reader of the archive from the pipe, decrypting it if a decrypter is set.
+func (v *Verify) archiveReader() (io.Reader, error) {
+	if v.decrypter == nil {
+		return v.pipe, nil
+	}
+
+	return v.decrypter.Decrypt(v.pipe)
+}
+
+// read reads the backup from the storage, writes it to the pipe and hashes it.
+func (v *Verify) read(ctx context.Context, objectParams storage.ObjectParams, contentHash hash.Hash) error {
+	err := v.storage.Read(ctx, io.MultiWriter(v.pipe, contentHash), objectParams)
+	if err != nil {
+		err = fmt.Errorf("read from storage: %w", err)
+		v.pipe.CloseWriteWithErr(err)
+
+		return err
+	}
+
+	v.pipe.CloseWrite()
+
+	return nil
+}
+
+// verifyFile reads the entry to the end and compares it with the source file, if the source is set.
+func (v *Verify) verifyFile(report *VerifyReport, file archive.File) error {
+	report.Entries++
+
+	var entryHash []byte
+
+	if file.Mode().IsRegular() && !isHardLink(file) {
+		var size int64
+		var err error
+
+		entryHash, size, err = hashEntry(file)
+		if err != nil {
+			return err
+		}
+
+		report.Bytes += size
+	}
+
+	if v.source == "" {
+		return nil
+	}
+
+	reason, err := v.compare(file, entryHash)
+	if err != nil {
+		return err
+	}
+
+	if reason != "" {
+		log.Warn("Mismatch", "path", file.NameInArchive, "reason", reason)
+		report.Mismatches = append(report.Mismatches, Mismatch{Path: file.NameInArchive, Reason: reason})
+	}
+
+	return nil
+}
+
+// compare returns the reason why the entry differs from the source file, or an empty string if they are the same.
+func (v *Verify) compare(file archive.File, entryHash []byte) (string, error) {
+	sourcePath, err := archive.EntryPath(v.source, file.NameInArchive)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Lstat(sourcePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return MismatchMissing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if info.Mode().Type() != file.Mode().Type() {
+		return MismatchType, nil
+	}
+
+	switch {
+	case file.Mode()&fs.ModeSymlink != 0:
+		linkTarget, err := os.Readlink(sourcePath)
+		if err != nil {
+			return "", err
+		}
+
+		if linkTarget != file.LinkTarget {
+			return MismatchLink, nil
+		}
+
+	case entryHash != nil:
+		// Size of a compressed stream is unknown until it is read, then only content is compared
+		if file.Size() >= 0 && info.Size() != file.Size() {
+			return MismatchSize, nil
+		}
+
+		sourceHash, err := hashFile(sourcePath)
+		if err != nil {
+			return "", err
+		}
+
+		if !bytes.Equal(sourceHash, entryHash) {
+			return MismatchContent, nil
+		}
+	}
+
+	return "", nil
+}
+
+// isHardLink reports whether the entry is a hard link to another entry, it has no content of its own.
+func isHardLink(file archive.File) bool {
+	header, ok := file.Header.(*tar.Header)
+
+	return ok && header.Typeflag == tar.TypeLink
+}
+
+// hashEntry reads the entry content to the end, returning its sha256 and size.
+func hashEntry(file archive.File) ([]byte, int64, error) {
+	content, err := file.Open()
+	if err != nil {
+		return nil, 0, fmt.Errorf("open entry: %w", err)
+	}
+	defer content.Close()
+
+	contentHash := sha256.New()
+
+	size, err := io.Copy(contentHash, content)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read entry: %w", err)
+	}
+
+	return contentHash.Sum(nil), size, nil
+}
+
+func hashFile(name string) ([]byte, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	contentHash := sha256.New()
+
+	_, err = io.Copy(contentHash, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return contentHash.Sum(nil), nil
+}
@@ -1,21 +1,80 @@
 package archive
 
 import (
+	"errors"
 	"fmt"
 	archiveAdapter "github.com/FirinKinuo/capyback/adapters/archive"
+	"github.com/FirinKinuo/capyback/filter"
+	"github.com/FirinKinuo/capyback/index"
+	"github.com/FirinKinuo/capyback/progress"
 	"github.com/mholt/archiver/v4"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
 const DefaultFormat = "tar.zst"
 
+// ErrorUnsupportedFormat is an error when the identified format can neither archive nor compress.
+var ErrorUnsupportedFormat = errors.New("unsupported archive format")
+
+// ErrorSourceRead is an error when files or a stream to archive can not be read.
+var ErrorSourceRead = archiveAdapter.ErrorSourceRead
+
+// ErrorUnsafePath is an error when an archive entry points outside the target directory.
+var ErrorUnsafePath = archiveAdapter.ErrorUnsafePath
+
+// Option configures an Archiver.
+type Option = archiveAdapter.Option
+
+// WithFilter excludes files matched by the filter from archives.
+func WithFilter(f *filter.Filter) Option {
+	return archiveAdapter.WithFilter(f)
+}
+
+// WithIndex records archived files in the index builder, and archives only files changed since its parent.
+func WithIndex(b *index.Builder) Option {
+	return archiveAdapter.WithIndex(b)
+}
+
+// WithProgress counts read files in the tracker, the total size of files is set before archiving.
+func WithProgress(t *progress.Tracker) Option {
+	return archiveAdapter.WithProgress(t)
+}
+
+// WithSpool spools streams into files in the directory, which must not exceed maxSize.
+// The default directory for temporary files is used when the directory is empty, maxSize <= 0 means no limit.
+func WithSpool(directory string, maxSize int64) Option {
+	return archiveAdapter.WithSpool(directory, maxSize)
+}
+
+// EntryPath returns the path the archive entry is restored to in the target directory,
+// or ErrorUnsafePath if the entry points outside the target.
+func EntryPath(target string, nameInArchive string) (string, error) {
+	return archiveAdapter.EntryPath(target, nameInArchive)
+}
+
 // IdentifyArchiver is a function to identify the archiving method of a file.
-func IdentifyArchiver(file string) (Archiver, error) {
+// A compression format without an archive, like "zst", stores a single file or stream,
+// which is restored under the file name without the compression extension.
+func IdentifyArchiver(file string, options ...Option) (Archiver, error) {
 	format, _, err := archiver.Identify(file, nil)
 	if err != nil {
 		return nil, fmt.Errorf("identify: %w", err)
 	}
 
-	// If we successfully identified the format, adapt it using NewArchiverAdapter
-	// and return the related Archiver
-	return archiveAdapter.NewArchiverAdapter(format.(archiver.Archival)), nil
+	switch format := format.(type) {
+	case archiver.Archival:
+		// If we successfully identified the format, adapt it using NewArchiverAdapter
+		// and return the related Archiver
+		return archiveAdapter.NewArchiverAdapter(format, options...), nil
+
+	case archiver.Compression:
+		name := strings.TrimSuffix(path.Base(filepath.ToSlash(file)), format.Name())
+
+		return archiveAdapter.NewCompressorAdapter(format, name), nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrorUnsupportedFormat, format.Name())
+	}
 }
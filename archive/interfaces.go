@@ -3,9 +3,26 @@ package archive
 import (
 	"context"
 	"io"
+
+	archiveAdapter "github.com/FirinKinuo/capyback/adapters/archive"
+
+	"github.com/mholt/archiver/v4"
 )
 
+// File is an entry of an archive.
+type File = archiver.File
+
+// Summary describes files, which would be archived.
+type Summary = archiveAdapter.Summary
+
 type Archiver interface {
 	Format() string
 	Archive(ctx context.Context, out io.Writer, files []string) error
+	// Scan walks the files as Archive would, without reading them.
+	Scan(ctx context.Context, files []string) (Summary, error)
+	// ArchiveStream archives content of the stream as a file named name, like output of a database dump.
+	ArchiveStream(ctx context.Context, out io.Writer, in io.Reader, name string) error
+	Extract(ctx context.Context, in io.Reader, target string) error
+	// Walk decodes the archive and calls handle for every entry, content of the entry can be read only inside handle.
+	Walk(ctx context.Context, in io.Reader, handle func(ctx context.Context, file File) error) error
 }
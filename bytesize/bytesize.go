@@ -0,0 +1,124 @@
+package bytesize
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Size is an amount of bytes, that can be written in a human-readable form like "64MiB" or "1.5GB".
+type Size int64
+
+const (
+	Byte Size = 1
+
+	KiB = 1024 * Byte
+	MiB = 1024 * KiB
+	GiB = 1024 * MiB
+	TiB = 1024 * GiB
+
+	KB = 1000 * Byte
+	MB = 1000 * KB
+	GB = 1000 * MB
+	TB = 1000 * GB
+)
+
+// ErrorInvalidSize is an error when the text can not be parsed as a size.
+var ErrorInvalidSize = errors.New("invalid size")
+
+// units maps lower-cased unit suffixes to their sizes.
+// Single letter suffixes are binary, as most tools treat them.
+var units = map[string]Size{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KiB,
+	"kib": KiB,
+	"kb":  KB,
+	"m":   MiB,
+	"mib": MiB,
+	"mb":  MB,
+	"g":   GiB,
+	"gib": GiB,
+	"gb":  GB,
+	"t":   TiB,
+	"tib": TiB,
+	"tb":  TB,
+}
+
+// Parse parses a size like "512", "64MiB", "1.5GB" or "20M".
+func Parse(text string) (Size, error) {
+	text = strings.TrimSpace(text)
+
+	unitStart := strings.IndexFunc(text, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if unitStart < 0 {
+		unitStart = len(text)
+	}
+
+	number, unit := text[:unitStart], strings.ToLower(strings.TrimSpace(text[unitStart:]))
+
+	multiplier, ok := units[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("%w: %q", ErrorInvalidSize, text)
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrorInvalidSize, text)
+	}
+
+	return Size(value * float64(multiplier)), nil
+}
+
+// binaryUnits are the units used to print sizes, from the largest to the smallest.
+var binaryUnits = []struct {
+	name string
+	size Size
+}{{"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB}}
+
+// String returns the size in the largest binary unit, rounded to two decimals.
+func (s Size) String() string {
+	for _, unit := range binaryUnits {
+		if s >= unit.size {
+			value := strconv.FormatFloat(float64(s)/float64(unit.size), 'f', 2, 64)
+			return strings.TrimSuffix(strings.TrimRight(value, "0"), ".") + unit.name
+		}
+	}
+
+	return strconv.FormatInt(int64(s), 10) + "B"
+}
+
+// Set parses the size from flag value.
+func (s *Size) Set(text string) error {
+	size, err := Parse(text)
+	if err != nil {
+		return err
+	}
+
+	*s = size
+	return nil
+}
+
+// Type returns the type name for flag usage.
+func (s *Size) Type() string {
+	return "size"
+}
+
+// MarshalText converts the Size to a []byte without losing precision.
+func (s Size) MarshalText() ([]byte, error) {
+	for _, unit := range binaryUnits {
+		if s >= unit.size && s%unit.size == 0 {
+			return []byte(strconv.FormatInt(int64(s/unit.size), 10) + unit.name), nil
+		}
+	}
+
+	return []byte(strconv.FormatInt(int64(s), 10)), nil
+}
+
+// UnmarshalText converts a []byte to a Size.
+func (s *Size) UnmarshalText(text []byte) error {
+	return s.Set(string(text))
+}
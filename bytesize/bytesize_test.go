@@ -0,0 +1,85 @@
+package bytesize
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Size
+		wantErr bool
+	}{
+		{text: "512", want: 512},
+		{text: "512B", want: 512},
+		{text: "64MiB", want: 64 * MiB},
+		{text: "64mib", want: 64 * MiB},
+		{text: "20M", want: 20 * MiB},
+		{text: "1.5GB", want: 1500 * MB},
+		{text: "2 KiB", want: 2 * KiB},
+		{text: " 1TB ", want: TB},
+		{text: "", wantErr: true},
+		{text: "MiB", wantErr: true},
+		{text: "10XB", wantErr: true},
+		{text: "1.2.3K", wantErr: true},
+		{text: "-5M", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := Parse(tt.text)
+			if tt.wantErr {
+				if !errors.Is(err, ErrorInvalidSize) {
+					t.Fatalf("Parse(%q) error = %v, want %v", tt.text, err, ErrorInvalidSize)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.text, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSizeText(t *testing.T) {
+	tests := []struct {
+		size       Size
+		wantString string
+		wantText   string
+	}{
+		{size: 0, wantString: "0B", wantText: "0"},
+		{size: 1000, wantString: "1000B", wantText: "1000"},
+		{size: 64 * MiB, wantString: "64MiB", wantText: "64MiB"},
+		{size: 1536 * KiB, wantString: "1.5MiB", wantText: "1536KiB"},
+		{size: MB, wantString: "976.56KiB", wantText: "1000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantString, func(t *testing.T) {
+			if got := tt.size.String(); got != tt.wantString {
+				t.Errorf("String() = %q, want %q", got, tt.wantString)
+			}
+
+			text, err := tt.size.MarshalText()
+			if err != nil {
+				t.Fatalf("MarshalText() error = %v", err)
+			}
+
+			if string(text) != tt.wantText {
+				t.Errorf("MarshalText() = %q, want %q", text, tt.wantText)
+			}
+
+			var parsed Size
+			err = parsed.UnmarshalText(text)
+			if err != nil || parsed != tt.size {
+				t.Errorf("UnmarshalText(%q) = %d, %v, want %d", text, parsed, err, tt.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package bytesize
+
+import (
+	"strings"
+)
+
+// rateSuffix is the optional suffix of a rate, "20MiB" and "20MiB/s" are the same rate.
+const rateSuffix = "/s"
+
+// Rate is an amount of bytes per second, that can be written in a human-readable form like "20MiB/s".
+type Rate Size
+
+// ParseRate parses a rate like "20MiB/s", "512K/s" or "10MB".
+func ParseRate(text string) (Rate, error) {
+	size, err := Parse(strings.TrimSuffix(strings.TrimSpace(text), rateSuffix))
+	if err != nil {
+		return 0, err
+	}
+
+	return Rate(size), nil
+}
+
+// String returns the rate in the largest binary unit per second.
+func (r Rate) String() string {
+	return Size(r).String() + rateSuffix
+}
+
+// Set parses the rate from flag value.
+func (r *Rate) Set(text string) error {
+	rate, err := ParseRate(text)
+	if err != nil {
+		return err
+	}
+
+	*r = rate
+	return nil
+}
+
+// Type returns the type name for flag usage.
+func (r *Rate) Type() string {
+	return "rate"
+}
+
+// MarshalText converts the Rate to a []byte without losing precision.
+func (r Rate) MarshalText() ([]byte, error) {
+	size, err := Size(r).MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(size, rateSuffix...), nil
+}
+
+// UnmarshalText converts a []byte to a Rate.
+func (r *Rate) UnmarshalText(text []byte) error {
+	return r.Set(string(text))
+}
@@ -0,0 +1,61 @@
+package bytesize
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Rate
+		wantErr bool
+	}{
+		{text: "20MiB/s", want: Rate(20 * MiB)},
+		{text: "20MiB", want: Rate(20 * MiB)},
+		{text: "512K/s", want: Rate(512 * KiB)},
+		{text: "10MB/s", want: Rate(10 * MB)},
+		{text: "0", want: 0},
+		{text: "/s", wantErr: true},
+		{text: "fast", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := ParseRate(tt.text)
+			if tt.wantErr {
+				if !errors.Is(err, ErrorInvalidSize) {
+					t.Fatalf("ParseRate(%q) error = %v, want %v", tt.text, err, ErrorInvalidSize)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseRate(%q) error = %v", tt.text, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseRate(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateText(t *testing.T) {
+	rate := Rate(20 * MiB)
+
+	if got := rate.String(); got != "20MiB/s" {
+		t.Errorf("String() = %q, want %q", got, "20MiB/s")
+	}
+
+	text, err := rate.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() error = %v", err)
+	}
+
+	var parsed Rate
+	err = parsed.UnmarshalText(text)
+	if err != nil || parsed != rate {
+		t.Errorf("UnmarshalText(%q) = %d, %v, want %d", text, parsed, err, rate)
+	}
+}
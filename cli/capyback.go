@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/FirinKinuo/capyback/cli/operation"
 
 	"github.com/spf13/cobra"
@@ -14,6 +17,8 @@ const (
 // Capyback is a root for start application from cli.
 type Capyback struct {
 	command *cobra.Command
+	// validated is set when flags and arguments of the command are valid, earlier errors are errors of configuration.
+	validated bool
 }
 
 // NewCapyback creates a new Capyback.
@@ -25,10 +30,27 @@ func NewCapyback(version string, defaultConfigPath string) *Capyback {
 		Short:   capybackDesc,
 		Long:    capybackDesc,
 		Version: version,
+		// Errors are logged by the caller of Execute, which exits with the code of the error
+		SilenceErrors: true,
+		PersistentPreRun: func(command *cobra.Command, _ []string) {
+			// Flags and arguments are valid at this point, usage is not printed for errors of the run
+			command.SilenceUsage = true
+			capyback.validated = true
+		},
 	}
 
+	capyback.command.SetFlagErrorFunc(func(command *cobra.Command, err error) error {
+		command.PrintErrln(command.UsageString())
+		return fmt.Errorf("%w: %w", operation.ErrorConfig, err)
+	})
+
 	defaultCommands := []CommandProvider{
 		operation.NewSave(defaultConfigPath),
+		operation.NewRun(defaultConfigPath),
+		operation.NewRestore(defaultConfigPath),
+		operation.NewVerify(defaultConfigPath),
+		operation.NewList(defaultConfigPath),
+		operation.NewPrune(defaultConfigPath),
 	}
 
 	capyback.RegisterCommands(defaultCommands...)
@@ -44,6 +66,12 @@ func (c *Capyback) RegisterCommands(providers ...CommandProvider) {
 }
 
 // Execute executes the command.
+// Errors of unknown commands, flags and arguments are returned as operation.ErrorConfig.
 func (c *Capyback) Execute() error {
-	return c.command.Execute()
+	err := c.command.Execute()
+	if err != nil && !c.validated && !errors.Is(err, operation.ErrorConfig) {
+		return fmt.Errorf("%w: %w", operation.ErrorConfig, err)
+	}
+
+	return err
 }
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"io"
+	"testing"
+)
+
+func TestExecuteExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "version", args: []string{"--version"}, want: ExitOK},
+		{name: "unknown command", args: []string{"backup"}, want: ExitConfig},
+		{name: "unknown flag", args: []string{"save", "--unknown", "file"}, want: ExitConfig},
+		{name: "save without resources", args: []string{"save"}, want: ExitConfig},
+		{name: "run without jobs", args: []string{"run"}, want: ExitConfig},
+		{name: "restore without backup", args: []string{"restore"}, want: ExitConfig},
+		{name: "list with arguments", args: []string{"list", "extra"}, want: ExitConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capyback := NewCapyback("test", "capyback.yml")
+			capyback.command.SetArgs(tt.args)
+			capyback.command.SetOut(io.Discard)
+			capyback.command.SetErr(io.Discard)
+
+			err := capyback.Execute()
+			if got := ExitCode(err); got != tt.want {
+				t.Errorf("exit code of %v = %d (%v), want %d", tt.args, got, err, tt.want)
+			}
+		})
+	}
+}
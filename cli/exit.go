@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/FirinKinuo/capyback/archive"
+	"github.com/FirinKinuo/capyback/cli/operation"
+	"github.com/FirinKinuo/capyback/storage"
+)
+
+// Exit codes of capyback, so scripts and schedulers can tell failures apart.
+const (
+	ExitOK             = 0
+	ExitFailure        = 1
+	ExitConfig         = 2
+	ExitAuthentication = 3
+	ExitSourceRead     = 4
+	ExitUpload         = 5
+	ExitPartialSuccess = 6
+	// ExitCancelled follows the shell convention for a process interrupted by SIGINT.
+	ExitCancelled = 130
+)
+
+// ExitCode returns the exit code of the error returned by Execute.
+// When the error has several causes, the first matching one in the order of the checks below wins.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, operation.ErrorCancelled):
+		return ExitCancelled
+	case errors.Is(err, operation.ErrorPartialSuccess):
+		return ExitPartialSuccess
+	case errors.Is(err, operation.ErrorConfig):
+		return ExitConfig
+	case errors.Is(err, storage.ErrorAuthentication):
+		return ExitAuthentication
+	case errors.Is(err, archive.ErrorSourceRead):
+		return ExitSourceRead
+	case errors.Is(err, storage.ErrorUpload):
+		return ExitUpload
+	default:
+		return ExitFailure
+	}
+}
@@ -7,6 +7,8 @@ import (
 // ArchiveFlagSet is a flag set for command with archiving.
 type ArchiveFlagSet struct {
 	Format string
+
+	flagSet *pflag.FlagSet
 }
 
 // NewArchiveFlagSet creates a new ArchiveFlagSet.
@@ -20,5 +22,14 @@ func (a *ArchiveFlagSet) FlagSet() *pflag.FlagSet {
 
 	flagSet.StringVarP(&a.Format, "format", "f", a.Format, "archive format")
 
+	a.flagSet = flagSet
+
 	return flagSet
 }
+
+// ApplyFormat sets the format from the flag, if the flag is set or the format is empty.
+func (a *ArchiveFlagSet) ApplyFormat(format *string) {
+	if *format == "" || (a.flagSet != nil && a.flagSet.Changed("format")) {
+		*format = a.Format
+	}
+}
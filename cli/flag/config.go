@@ -1,7 +1,10 @@
 package flag
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+
 	"github.com/FirinKinuo/capyback/config"
 	"github.com/spf13/pflag"
 )
@@ -9,18 +12,20 @@ import (
 // ConfigFlagSet is a flag set for configuration application.
 type ConfigFlagSet struct {
 	Path string
+
+	defaultPath string
 }
 
 // NewConfigFlagSet creates a new ConfigFlagSet.
 func NewConfigFlagSet(defaultPath string) *ConfigFlagSet {
-	return &ConfigFlagSet{Path: defaultPath}
+	return &ConfigFlagSet{Path: defaultPath, defaultPath: defaultPath}
 }
 
 // FlagSet returns a flag set for configuration application.
 func (c *ConfigFlagSet) FlagSet() *pflag.FlagSet {
 	flagSet := pflag.NewFlagSet("config", pflag.PanicOnError)
 
-	flagSet.StringVarP(&c.Path, "config", "c", c.Path, "config path")
+	flagSet.StringVarP(&c.Path, "config", "c", c.Path, "config path, set empty to configure only with environment and flags")
 
 	return flagSet
 }
@@ -35,3 +40,28 @@ func (c *ConfigFlagSet) ReadYamlConfig() (*config.Config, error) {
 
 	return yamlConfig, nil
 }
+
+// ReadConfig reads a config layered as defaults < yaml file < environment.
+// A config file missing at the default path is skipped, a file set explicitly must exist.
+func (c *ConfigFlagSet) ReadConfig() (*config.Config, error) {
+	appConfig := config.NewConfig()
+
+	if c.Path != "" {
+		yamlConfig, err := c.ReadYamlConfig()
+
+		switch {
+		case err == nil:
+			appConfig = yamlConfig
+		case errors.Is(err, fs.ErrNotExist) && c.Path == c.defaultPath:
+		default:
+			return nil, err
+		}
+	}
+
+	err := appConfig.ReadFromEnviron()
+	if err != nil {
+		return nil, fmt.Errorf("read environ: %w", err)
+	}
+
+	return appConfig, nil
+}
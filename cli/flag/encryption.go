@@ -0,0 +1,81 @@
+package flag
+
+import (
+	"github.com/FirinKinuo/capyback/crypt"
+
+	"github.com/spf13/pflag"
+)
+
+// EncryptionFlagSet is a flag set for command with encryption or decryption of backups.
+type EncryptionFlagSet struct {
+	Encrypt        bool
+	Recipients     []string
+	RecipientsFile string
+	IdentityFile   string
+	PassphraseFile string
+}
+
+// NewEncryptionFlagSet creates a new EncryptionFlagSet.
+func NewEncryptionFlagSet() *EncryptionFlagSet {
+	return &EncryptionFlagSet{}
+}
+
+// EncryptFlagSet returns a flag set for command with encryption.
+func (e *EncryptionFlagSet) EncryptFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("encrypt", pflag.PanicOnError)
+
+	flagSet.BoolVar(
+		&e.Encrypt,
+		"encrypt",
+		false,
+		"encrypt backup, the passphrase is read from CAPYBACK_PASSPHRASE unless recipients or a passphrase file are set",
+	)
+	flagSet.StringSliceVarP(&e.Recipients, "recipient", "r", nil, "encrypt backup to age recipient (age1...), can be repeated")
+	flagSet.StringVar(&e.RecipientsFile, "recipients-file", "", "encrypt backup to age recipients listed in file")
+	flagSet.StringVar(&e.PassphraseFile, "passphrase-file", "", "encrypt backup with passphrase from file")
+	flagSet.StringVarP(
+		&e.IdentityFile,
+		"identity-file",
+		"i",
+		"",
+		"read the encrypted index of the previous backup with age identities from file, used with --incremental",
+	)
+
+	return flagSet
+}
+
+// DecryptFlagSet returns a flag set for command with decryption.
+func (e *EncryptionFlagSet) DecryptFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("decrypt", pflag.PanicOnError)
+
+	flagSet.StringVarP(&e.IdentityFile, "identity-file", "i", "", "decrypt backup with age identities from file")
+	flagSet.StringVar(
+		&e.PassphraseFile,
+		"passphrase-file",
+		"",
+		"decrypt backup with passphrase from file, CAPYBACK_PASSPHRASE is used unless an identity file is set",
+	)
+
+	return flagSet
+}
+
+// Apply overrides the encryption config with set flags.
+func (e *EncryptionFlagSet) Apply(config *crypt.Config) {
+	if e.Encrypt {
+		config.Enabled = true
+	}
+
+	config.Recipients = append(config.Recipients, e.Recipients...)
+
+	if e.RecipientsFile != "" {
+		config.RecipientsFile = e.RecipientsFile
+	}
+
+	if e.IdentityFile != "" {
+		config.IdentityFile = e.IdentityFile
+	}
+
+	if e.PassphraseFile != "" {
+		config.PassphraseFile = e.PassphraseFile
+	}
+}
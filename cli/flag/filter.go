@@ -0,0 +1,56 @@
+package flag
+
+import (
+	"github.com/FirinKinuo/capyback/filter"
+
+	"github.com/spf13/pflag"
+)
+
+// FilterFlagSet is a flag set for command with excluding files from backup.
+type FilterFlagSet struct {
+	Exclude     []string
+	Include     []string
+	ExcludeFrom []string
+	IgnoreFiles []string
+}
+
+// NewFilterFlagSet creates a new FilterFlagSet.
+func NewFilterFlagSet() *FilterFlagSet {
+	return &FilterFlagSet{}
+}
+
+// FlagSet returns a flag set for command with excluding files from backup.
+func (f *FilterFlagSet) FlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("filter", pflag.PanicOnError)
+
+	flagSet.StringArrayVarP(
+		&f.Exclude,
+		"exclude",
+		"e",
+		nil,
+		"exclude files matching gitignore-style pattern, example: \"node_modules/\". Can be repeated",
+	)
+	flagSet.StringArrayVar(
+		&f.Include,
+		"include",
+		nil,
+		"include files matching pattern even if they are excluded, excluded directories are not walked. Can be repeated",
+	)
+	flagSet.StringArrayVar(&f.ExcludeFrom, "exclude-from", nil, "read exclude patterns from file. Can be repeated")
+	flagSet.StringArrayVar(
+		&f.IgnoreFiles,
+		"ignore-file",
+		nil,
+		"honor ignore files with this name in every directory, example: .gitignore or .capybackignore. Can be repeated",
+	)
+
+	return flagSet
+}
+
+// Apply extends the filter config with set flags.
+func (f *FilterFlagSet) Apply(config *filter.Config) {
+	config.Exclude = append(config.Exclude, f.Exclude...)
+	config.Include = append(config.Include, f.Include...)
+	config.ExcludeFrom = append(config.ExcludeFrom, f.ExcludeFrom...)
+	config.IgnoreFiles = append(config.IgnoreFiles, f.IgnoreFiles...)
+}
@@ -0,0 +1,50 @@
+package flag
+
+import (
+	"github.com/FirinKinuo/capyback/bytesize"
+	"github.com/FirinKinuo/capyback/pipe"
+
+	"github.com/spf13/pflag"
+)
+
+// PipeFlagSet is a flag set for command with a pipe between the archiver and the storage.
+type PipeFlagSet struct {
+	PipeType  pipe.Type
+	Directory string
+	MaxSize   bytesize.Size
+}
+
+// NewPipeFlagSet creates a new PipeFlagSet.
+func NewPipeFlagSet() *PipeFlagSet {
+	return &PipeFlagSet{}
+}
+
+// FlagSet returns a flag set for command with a pipe.
+func (p *PipeFlagSet) FlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("pipe", pflag.PanicOnError)
+
+	flagSet.Var(
+		&p.PipeType,
+		"pipe",
+		"pipe between archiver and storage: in-memory or spool, spool buffers backup into a temp file to retry uploads",
+	)
+	flagSet.StringVar(&p.Directory, "spool-dir", "", "directory of spool files and of streams spooled to archive them, the system temp directory by default")
+	flagSet.Var(&p.MaxSize, "spool-max-size", "max size of a spool file and of a spooled stream, example: 20GiB (default no limit)")
+
+	return flagSet
+}
+
+// Apply overrides the pipe config with set flags.
+func (p *PipeFlagSet) Apply(config *pipe.Config) {
+	if p.PipeType != "" {
+		config.Type = p.PipeType
+	}
+
+	if p.Directory != "" {
+		config.Directory = p.Directory
+	}
+
+	if p.MaxSize != 0 {
+		config.MaxSize = p.MaxSize
+	}
+}
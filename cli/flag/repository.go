@@ -0,0 +1,38 @@
+package flag
+
+import (
+	"github.com/FirinKinuo/capyback/repository"
+
+	"github.com/spf13/pflag"
+)
+
+// RepositoryFlagSet is a flag set for command with the deduplicated repository.
+type RepositoryFlagSet struct {
+	Enabled bool
+}
+
+// NewRepositoryFlagSet creates a new RepositoryFlagSet.
+func NewRepositoryFlagSet() *RepositoryFlagSet {
+	return &RepositoryFlagSet{}
+}
+
+// FlagSet returns a flag set for command with the repository.
+func (r *RepositoryFlagSet) FlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("repository", pflag.PanicOnError)
+
+	flagSet.BoolVar(
+		&r.Enabled,
+		"repository",
+		false,
+		"store backups in the deduplicated repository: backups are split into chunks, which are stored once",
+	)
+
+	return flagSet
+}
+
+// Apply overrides the repository config with set flags.
+func (r *RepositoryFlagSet) Apply(config *repository.Config) {
+	if r.Enabled {
+		config.Enabled = true
+	}
+}
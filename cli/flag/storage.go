@@ -1,18 +1,30 @@
 package flag
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/FirinKinuo/capyback/bytesize"
 	"github.com/FirinKinuo/capyback/storage"
 
 	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
+// ErrorInvalidStorageParam is an error when a storage param flag is not in key=value form.
+var ErrorInvalidStorageParam = errors.New("storage param must be in key=value form")
+
 // StorageFlagSet is a flag set for command with storage using.
 type StorageFlagSet struct {
 	StorageType storage.Type
+	Params      []string
+	LimitUpload bytesize.Rate
 
 	swift *SwiftStorageFlagSet
+
+	flagSet *pflag.FlagSet
 }
 
 // NewStorageFlagSet creates a new StorageFlagSet.
@@ -31,22 +43,96 @@ func (s *StorageFlagSet) FlagSet() *pflag.FlagSet {
 		"storage",
 		fmt.Sprintf("Type of storage (%s)", storage.StringAvailableStorages()),
 	)
+	flagSet.StringArrayVar(
+		&s.Params,
+		"storage-param",
+		nil,
+		"Set storage param as key=value, the value is parsed as yaml. Can be repeated, example: --storage-param directory=/backups",
+	)
+
+	flagSet.Var(
+		&s.LimitUpload,
+		"limit-upload",
+		"Limit the upload rate, example: 20MiB/s. Replaces the bandwidth schedule of the config, 0 disables the limit.",
+	)
 
 	flagSet.AddFlagSet(s.swift.FlagSet())
 
+	s.flagSet = flagSet
+
 	return flagSet
 }
 
-// WriteParams returns a write params for storage.
-func (s *StorageFlagSet) WriteParams() storage.WriteParams {
-	return s.swift.WriteParams()
+// Apply overrides the storage config with set flags.
+func (s *StorageFlagSet) Apply(config *storage.Config) error {
+	if s.StorageType != "" && s.StorageType != config.StorageType {
+		config.StorageType = s.StorageType
+
+		// Environment params depend on the storage type, so they are read again for the new one
+		err := config.ReadParamsFromEnviron()
+		if err != nil {
+			return fmt.Errorf("read storage environ: %w", err)
+		}
+	}
+
+	params, err := s.parseParams()
+	if err != nil {
+		return fmt.Errorf("parse storage params: %w", err)
+	}
+
+	err = config.MergeParams(params)
+	if err != nil {
+		return fmt.Errorf("merge storage params: %w", err)
+	}
+
+	// Flags of a storage type are params of that type only, they must not leak into params of another storage
+	if config.StorageType == storage.SwiftStorageType {
+		err = config.MergeParams(s.swift)
+		if err != nil {
+			return fmt.Errorf("merge swift params: %w", err)
+		}
+	}
+
+	if s.flagSet != nil && s.flagSet.Changed("limit-upload") {
+		config.Bandwidth = storage.BandwidthConfig{Upload: s.LimitUpload}
+	}
+
+	return nil
+}
+
+func (s *StorageFlagSet) parseParams() (map[string]any, error) {
+	params := make(map[string]any, len(s.Params))
+
+	for _, param := range s.Params {
+		key, value, found := strings.Cut(param, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("%w: %q", ErrorInvalidStorageParam, param)
+		}
+
+		var parsedValue any
+
+		err := yaml.Unmarshal([]byte(value), &parsedValue)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s value: %w", key, err)
+		}
+
+		params[key] = parsedValue
+	}
+
+	return params, nil
 }
 
 // SwiftStorageFlagSet is a flag set for Swift Storage configuration.
 type SwiftStorageFlagSet struct {
-	Container   string
-	Hash        string
-	ContentType string
+	Container   string `yaml:"container,omitempty"`
+	Hash        string `yaml:"hash,omitempty"`
+	ContentType string `yaml:"content-type,omitempty"`
+
+	SegmentSize      bytesize.Size `yaml:"segment-size,omitempty"`
+	SegmentContainer string        `yaml:"segment-container,omitempty"`
+
+	DeleteAfter time.Duration     `yaml:"delete-after,omitempty"`
+	Metadata    map[string]string `yaml:"metadata,omitempty"`
 }
 
 // NewSwiftStorageFlagSet creates a new SwiftStorageFlagSet.
@@ -54,15 +140,6 @@ func NewSwiftStorageFlagSet() *SwiftStorageFlagSet {
 	return &SwiftStorageFlagSet{}
 }
 
-// WriteParams returns a write params for Swift Storage.
-func (s *SwiftStorageFlagSet) WriteParams() storage.WriteParams {
-	return &storage.SwiftWriteParams{
-		Container:   s.Container,
-		Hash:        s.Hash,
-		ContentType: s.ContentType,
-	}
-}
-
 // FlagSet returns a flag set for Swift Storage configuration.
 func (s *SwiftStorageFlagSet) FlagSet() *pflag.FlagSet {
 	flagSet := pflag.NewFlagSet("swift-storage", pflag.PanicOnError)
@@ -71,7 +148,7 @@ func (s *SwiftStorageFlagSet) FlagSet() *pflag.FlagSet {
 		&s.Container,
 		"swift-container",
 		"",
-		"Specify the container in Swift Storage where the objects are stored. This flag is required.",
+		"Specify the container in Swift Storage where the objects are stored. Required unless set in config or SWIFT_STORAGE_CONTAINER.",
 	)
 	flagSet.StringVar(
 		&s.Hash,
@@ -85,5 +162,28 @@ func (s *SwiftStorageFlagSet) FlagSet() *pflag.FlagSet {
 		"",
 		"Set the content type of the object in Swift Storage. This value is used by the system to understand how to handle the object.",
 	)
+	flagSet.Var(
+		&s.SegmentSize,
+		"swift-segment-size",
+		"Upload the object as a Static Large Object in segments of this size, example: 1GiB. Required for objects over 5GiB. Every segment is buffered in memory.",
+	)
+	flagSet.StringVar(
+		&s.SegmentContainer,
+		"swift-segment-container",
+		"",
+		"Set the container of Static Large Object segments. Defaults to the container with \"_segments\" suffix.",
+	)
+	flagSet.DurationVar(
+		&s.DeleteAfter,
+		"swift-delete-after",
+		0,
+		"Make Swift Storage delete the object after the duration since the upload, example: 720h.",
+	)
+	flagSet.StringToStringVar(
+		&s.Metadata,
+		"swift-meta",
+		nil,
+		"Add X-Object-Meta-* metadata to the object in Swift Storage, example: --swift-meta owner=ops,env=prod.",
+	)
 	return flagSet
 }
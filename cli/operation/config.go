@@ -0,0 +1,78 @@
+package operation
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/FirinKinuo/capyback/cli/flag"
+	"github.com/FirinKinuo/capyback/config"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/repository"
+	"github.com/FirinKinuo/capyback/storage"
+)
+
+// readConfig reads the application config layered as defaults < yaml file < environment < flags.
+func readConfig(
+	configFlagSet *flag.ConfigFlagSet,
+	storageFlagSet *flag.StorageFlagSet,
+	repositoryFlagSet *flag.RepositoryFlagSet,
+) (*config.Config, error) {
+	appConfig, err := configFlagSet.ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	repositoryFlagSet.Apply(&appConfig.Repository)
+
+	err = storageFlagSet.Apply(&appConfig.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("apply storage flags: %w", err)
+	}
+
+	return appConfig, nil
+}
+
+// readOptionalDecrypter reads the decrypter of the encryption config, or returns nil if no identity is configured.
+func readOptionalDecrypter(encryptionConfig *crypt.Config) (crypt.Decrypter, error) {
+	decrypter, err := encryptionConfig.ReadDecrypter()
+	if errors.Is(err, crypt.ErrorNoIdentities) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read decrypter: %w", err)
+	}
+
+	return decrypter, nil
+}
+
+// readStorage reads the storage of the storage config, which is wrapped into the repository if it is enabled.
+// The encrypter and the decrypter are used for objects of the repository and may be nil.
+func readStorage(
+	appConfig *config.Config,
+	storageConfig *storage.Config,
+	encrypter crypt.Encrypter,
+	decrypter crypt.Decrypter,
+) (storage.Storager, error) {
+	storager, err := storageConfig.ReadStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	if !appConfig.Repository.Enabled {
+		return storager, nil
+	}
+
+	repo, err := repository.NewRepository(storager, storageConfig, &appConfig.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("open repository: %w", err)
+	}
+
+	if encrypter != nil {
+		repo.SetEncrypter(encrypter)
+	}
+	if decrypter != nil {
+		repo.SetDecrypter(decrypter)
+	}
+
+	return repo, nil
+}
@@ -0,0 +1,33 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+)
+
+var (
+	// ErrorConfig is an error when the command can not be configured from flags, the config and the environment.
+	ErrorConfig = errors.New("invalid configuration")
+	// ErrorCancelled is an error when the command was interrupted by a signal.
+	ErrorCancelled = errors.New("cancelled")
+	// ErrorPartialSuccess is an error when backups were written, but some backups or steps after them failed.
+	ErrorPartialSuccess = errors.New("completed with errors")
+)
+
+// configError marks the error of command configuration as ErrorConfig.
+func configError(err error) error {
+	return fmt.Errorf("%w: %w", ErrorConfig, err)
+}
+
+// performError describes the failed operation, the error of an operation interrupted by a signal is ErrorCancelled.
+func performError(ctx context.Context, operation string, err error) error {
+	if ctx.Err() != nil {
+		log.Infof("%s cancelled", operation)
+		return fmt.Errorf("%s: %w", operation, ErrorCancelled)
+	}
+
+	return fmt.Errorf("%s: %w", operation, err)
+}
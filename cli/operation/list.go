@@ -0,0 +1,214 @@
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/FirinKinuo/capyback/bytesize"
+	"github.com/FirinKinuo/capyback/cli/flag"
+	"github.com/FirinKinuo/capyback/config"
+	"github.com/FirinKinuo/capyback/index"
+	"github.com/FirinKinuo/capyback/repository"
+	"github.com/FirinKinuo/capyback/storage"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	listOutputTable = "table"
+	listOutputJson  = "json"
+)
+
+// ErrorUnknownListOutput is an error when the list output format is not supported.
+var ErrorUnknownListOutput = errors.New("unknown output format, available: table, json")
+
+// List is a command for list backups stored in storage.
+type List struct {
+	command   *cobra.Command
+	appConfig *config.Config
+
+	prefix       string
+	output       string
+	withMetadata bool
+
+	storageFlagSet    *flag.StorageFlagSet
+	configFlagSet     *flag.ConfigFlagSet
+	repositoryFlagSet *flag.RepositoryFlagSet
+
+	storager storage.Storager
+}
+
+// NewList creates a new List.
+func NewList(defaultConfigPath string) *List {
+	list := &List{
+		storageFlagSet:    flag.NewStorageFlagSet(),
+		configFlagSet:     flag.NewConfigFlagSet(defaultConfigPath),
+		repositoryFlagSet: flag.NewRepositoryFlagSet(),
+	}
+
+	command := &cobra.Command{
+		Use:   "list",
+		Short: "List backups in storage",
+		Args:  cobra.NoArgs,
+		RunE:  list.run,
+	}
+
+	command.PersistentFlags().AddFlagSet(list.FlagSet())
+
+	list.command = command
+
+	return list
+}
+
+// FlagSet returns a flag set for list command.
+func (l *List) FlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("list", pflag.PanicOnError)
+
+	flagSet.StringVarP(&l.prefix, "prefix", "p", "", "show only backups which names start with prefix")
+	flagSet.StringVar(&l.output, "output", listOutputTable, "output format (table, json)")
+	flagSet.BoolVar(&l.withMetadata, "metadata", false, "request metadata of every backup, may be slow on large storages")
+
+	flagSet.AddFlagSet(l.storageFlagSet.FlagSet())
+	flagSet.AddFlagSet(l.configFlagSet.FlagSet())
+	flagSet.AddFlagSet(l.repositoryFlagSet.FlagSet())
+
+	return flagSet
+}
+
+func (l *List) Command() *cobra.Command {
+	return l.command
+}
+
+// configure configures the list command from flag sets.
+func (l *List) configure() error {
+	if l.output != listOutputTable && l.output != listOutputJson {
+		return ErrorUnknownListOutput
+	}
+
+	var err error
+	l.appConfig, err = readConfig(l.configFlagSet, l.storageFlagSet, l.repositoryFlagSet)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	backupStorage, err := readStorage(l.appConfig, &l.appConfig.Storage, nil, nil)
+	if err != nil {
+		return fmt.Errorf("read storager: %w", err)
+	}
+
+	l.storager = backupStorage
+
+	return nil
+}
+
+func (l *List) performList(ctx context.Context) ([]storage.Object, error) {
+	err := l.storager.Authenticate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate storage: %w", err)
+	}
+
+	listParams, err := l.appConfig.Storage.ReadListParams()
+	if err != nil {
+		return nil, fmt.Errorf("read list params: %w", err)
+	}
+	listParams.SetPrefix(l.prefix)
+	listParams.SetWithMetadata(l.withMetadata)
+
+	objects, err := l.storager.List(ctx, listParams)
+	if err != nil {
+		return nil, fmt.Errorf("list storage: %w", err)
+	}
+
+	// Indexes and objects of a repository in the same storage are not backups
+	objects = slices.DeleteFunc(objects, func(object storage.Object) bool {
+		return index.IsIndex(object.Name) || repository.IsInternal(object.Name)
+	})
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name < objects[j].Name
+	})
+
+	return objects, nil
+}
+
+func (l *List) writeJson(out io.Writer, objects []storage.Object) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(objects)
+}
+
+func (l *List) writeTable(out io.Writer, objects []storage.Object) error {
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	header := "NAME\tSIZE\tMODIFIED\tHASH"
+	if l.withMetadata {
+		header += "\tMETADATA"
+	}
+	_, _ = fmt.Fprintln(table, header)
+
+	for _, object := range objects {
+		row := fmt.Sprintf(
+			"%s\t%s\t%s\t%s",
+			object.Name,
+			bytesize.Size(object.Size),
+			object.LastModified.Local().Format(time.DateTime),
+			object.Hash,
+		)
+		if l.withMetadata {
+			row += "\t" + l.formatMetadata(object.Metadata)
+		}
+		_, _ = fmt.Fprintln(table, row)
+	}
+
+	return table.Flush()
+}
+
+func (l *List) formatMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func (l *List) run(_ *cobra.Command, _ []string) error {
+	err := l.configure()
+	if err != nil {
+		return configError(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	objects, err := l.performList(ctx)
+	if err != nil {
+		return performError(ctx, "perform list", err)
+	}
+
+	switch l.output {
+	case listOutputJson:
+		err = l.writeJson(os.Stdout, objects)
+	default:
+		err = l.writeTable(os.Stdout, objects)
+	}
+	if err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+
+	return nil
+}
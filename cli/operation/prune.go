@@ -0,0 +1,191 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/FirinKinuo/capyback/application"
+	"github.com/FirinKinuo/capyback/cli/flag"
+	"github.com/FirinKinuo/capyback/config"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/repository"
+	"github.com/FirinKinuo/capyback/retention"
+	"github.com/FirinKinuo/capyback/storage"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// ErrorNoRetentionPolicies is an error when prune is requested without retention policies in config.
+var ErrorNoRetentionPolicies = errors.New("retention policies are not configured")
+
+// Prune is a command for remove backups from storage according to retention policies.
+type Prune struct {
+	command   *cobra.Command
+	appConfig *config.Config
+
+	dryRun bool
+
+	storageFlagSet    *flag.StorageFlagSet
+	configFlagSet     *flag.ConfigFlagSet
+	encryptionFlagSet *flag.EncryptionFlagSet
+	repositoryFlagSet *flag.RepositoryFlagSet
+
+	storager  storage.Storager
+	decrypter crypt.Decrypter
+}
+
+// NewPrune creates a new Prune.
+func NewPrune(defaultConfigPath string) *Prune {
+	prune := &Prune{
+		storageFlagSet:    flag.NewStorageFlagSet(),
+		configFlagSet:     flag.NewConfigFlagSet(defaultConfigPath),
+		encryptionFlagSet: flag.NewEncryptionFlagSet(),
+		repositoryFlagSet: flag.NewRepositoryFlagSet(),
+	}
+
+	command := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove backups according to retention policies",
+		Args:  cobra.NoArgs,
+		RunE:  prune.run,
+	}
+
+	command.PersistentFlags().AddFlagSet(prune.FlagSet())
+
+	prune.command = command
+
+	return prune
+}
+
+// FlagSet returns a flag set for prune command.
+func (p *Prune) FlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("prune", pflag.PanicOnError)
+
+	flagSet.BoolVarP(&p.dryRun, "dry-run", "n", false, "only show which backups would be removed")
+
+	flagSet.AddFlagSet(p.storageFlagSet.FlagSet())
+	flagSet.AddFlagSet(p.configFlagSet.FlagSet())
+	flagSet.AddFlagSet(p.repositoryFlagSet.FlagSet())
+	flagSet.AddFlagSet(p.encryptionFlagSet.DecryptFlagSet())
+
+	return flagSet
+}
+
+func (p *Prune) Command() *cobra.Command {
+	return p.command
+}
+
+// configure configures the prune command from flag sets.
+func (p *Prune) configure() error {
+	var err error
+	p.appConfig, err = readConfig(p.configFlagSet, p.storageFlagSet, p.repositoryFlagSet)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	if len(p.appConfig.Retention.Policies) == 0 {
+		return ErrorNoRetentionPolicies
+	}
+
+	// Encrypted indexes of incremental backups are read to keep parents of kept backups,
+	// and encrypted snapshots of the repository are read to find unreferenced chunks
+	p.encryptionFlagSet.Apply(&p.appConfig.Encryption)
+
+	p.decrypter, err = readOptionalDecrypter(&p.appConfig.Encryption)
+	if err != nil {
+		return err
+	}
+
+	backupStorage, err := readStorage(p.appConfig, &p.appConfig.Storage, nil, p.decrypter)
+	if err != nil {
+		return fmt.Errorf("read storager: %w", err)
+	}
+
+	p.storager = backupStorage
+
+	return nil
+}
+
+func (p *Prune) run(_ *cobra.Command, _ []string) error {
+	err := p.configure()
+	if err != nil {
+		return configError(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = p.storager.Authenticate(ctx)
+	if err != nil {
+		return performError(ctx, "authenticate storage", err)
+	}
+
+	err = performPrune(ctx, p.storager, p.decrypter, &p.appConfig.Storage, p.appConfig.Retention.Policies, p.dryRun)
+	if err != nil {
+		return performError(ctx, "perform prune", err)
+	}
+
+	return nil
+}
+
+// performPrune removes backups from the authenticated storage according to retention policies.
+// Parents of kept incremental backups are kept, the decrypter reads encrypted indexes and may be nil.
+// Chunks of the repository, which are no longer referenced by backups, are removed after backups.
+func performPrune(
+	ctx context.Context,
+	storager storage.Storager,
+	decrypter crypt.Decrypter,
+	storageConfig *storage.Config,
+	policies []retention.Policy,
+	dryRun bool,
+) error {
+	listParams, err := storageConfig.ReadListParams()
+	if err != nil {
+		return fmt.Errorf("read list params: %w", err)
+	}
+
+	objectParams, err := storageConfig.ReadObjectParams()
+	if err != nil {
+		return fmt.Errorf("read object params: %w", err)
+	}
+
+	indexes := application.NewIndexes(storager)
+	if decrypter != nil {
+		indexes.SetDecrypter(decrypter)
+	}
+
+	prune := application.NewPrune(storager, policies)
+	prune.SetIndexes(indexes)
+
+	removed, err := prune.Prune(ctx, listParams, objectParams, dryRun)
+	if err != nil {
+		return fmt.Errorf("prune: %w", err)
+	}
+
+	repo, ok := storager.(*repository.Repository)
+	if !ok {
+		return nil
+	}
+
+	removedNames := make([]string, 0, len(removed))
+	for _, object := range removed {
+		removedNames = append(removedNames, object.Name)
+	}
+
+	err = repo.Collect(ctx, removedNames, dryRun)
+	if errors.Is(err, repository.ErrorEncryptedObject) {
+		log.Warn("Chunks of removed backups are kept, an identity or a passphrase is required to read snapshots")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("collect chunks: %w", err)
+	}
+
+	return nil
+}
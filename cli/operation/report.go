@@ -0,0 +1,180 @@
+package operation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/FirinKinuo/capyback/application"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrorUnknownReportFormat is an error when the format of the run report is not supported.
+var ErrorUnknownReportFormat = errors.New("unknown report format, available: json, yaml")
+
+// Statuses of a backup and of a run in the report.
+const (
+	reportStatusSuccess   = "success"
+	reportStatusFailure   = "failure"
+	reportStatusCancelled = "cancelled"
+)
+
+// ReportFormat is a format of the run report.
+type ReportFormat string
+
+const (
+	JSONReportFormat ReportFormat = "json"
+	YAMLReportFormat ReportFormat = "yaml"
+)
+
+// String returns the string representation of the ReportFormat.
+func (f ReportFormat) String() string {
+	return string(f)
+}
+
+// Set sets the ReportFormat from a flag value.
+func (f *ReportFormat) Set(value string) error {
+	switch ReportFormat(strings.ToLower(value)) {
+	case JSONReportFormat:
+		*f = JSONReportFormat
+	case YAMLReportFormat, "yml":
+		*f = YAMLReportFormat
+	default:
+		return fmt.Errorf("%w: %q", ErrorUnknownReportFormat, value)
+	}
+
+	return nil
+}
+
+// Type returns the name of the ReportFormat flag value.
+func (f *ReportFormat) Type() string {
+	return "report-format"
+}
+
+// runReport is a machine-readable result of a save run for monitoring, one record for every backup.
+type runReport struct {
+	Version  string         `json:"version" yaml:"version"`
+	Host     string         `json:"host" yaml:"host"`
+	Started  time.Time      `json:"started" yaml:"started"`
+	Finished time.Time      `json:"finished" yaml:"finished"`
+	DryRun   bool           `json:"dry-run,omitempty" yaml:"dry-run,omitempty"`
+	Status   string         `json:"status" yaml:"status"`
+	Backups  []backupReport `json:"backups" yaml:"backups"`
+}
+
+// backupReport is a result of a backup of one task, size and checksum are set when it was written.
+type backupReport struct {
+	Job        string  `json:"job,omitempty" yaml:"job,omitempty"`
+	Name       string  `json:"name" yaml:"name"`
+	Format     string  `json:"format" yaml:"format"`
+	Storage    string  `json:"storage" yaml:"storage"`
+	Target     string  `json:"target,omitempty" yaml:"target,omitempty"`
+	Encrypted  bool    `json:"encrypted" yaml:"encrypted"`
+	Repository bool    `json:"repository" yaml:"repository"`
+	Size       int64   `json:"size" yaml:"size"`
+	Files      int64   `json:"files" yaml:"files"`
+	SHA256     string  `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	Duration   float64 `json:"duration-seconds" yaml:"duration-seconds"`
+	Status     string  `json:"status" yaml:"status"`
+	Error      string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// newBackupReport describes the backup of the task with its result, the result is nil when the backup failed.
+// The duration of the task is reported, when there is no result.
+func newBackupReport(task *saveTask, result *application.BackupResult, duration time.Duration, err error) backupReport {
+	report := backupReport{
+		Job:        task.jobName,
+		Name:       task.backupName,
+		Format:     task.archiver.Format(),
+		Storage:    task.storageConfig.StorageType.String(),
+		Target:     task.storageConfig.Target(),
+		Encrypted:  task.encrypter != nil,
+		Repository: task.repository,
+		Duration:   duration.Seconds(),
+		Status:     reportStatusSuccess,
+	}
+
+	if result != nil {
+		report.Duration = result.Duration.Seconds()
+		report.Size = result.Size
+		report.Files = result.Files
+		report.SHA256 = result.SHA256
+	}
+
+	if err != nil {
+		report.Status = reportStatusFailure
+		report.Error = err.Error()
+	}
+
+	return report
+}
+
+// finish sets the end and the status of the run.
+func (r *runReport) finish(cancelled bool) {
+	r.Finished = time.Now()
+	r.Status = reportStatusSuccess
+
+	for _, backup := range r.Backups {
+		if backup.Status != reportStatusSuccess {
+			r.Status = reportStatusFailure
+		}
+	}
+
+	if cancelled {
+		r.Status = reportStatusCancelled
+	}
+}
+
+// write writes the report in the format to the file, or to stdout if the file is empty.
+// Without a format, it is chosen by the file extension, json is the default.
+func (r *runReport) write(format ReportFormat, file string) error {
+	if format == "" {
+		format = JSONReportFormat
+
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml":
+			format = YAMLReportFormat
+		}
+	}
+
+	if file == "" {
+		return r.encode(os.Stdout, format)
+	}
+
+	output, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("create report file: %w", err)
+	}
+	defer output.Close()
+
+	err = r.encode(output, format)
+	if err != nil {
+		return err
+	}
+
+	return output.Close()
+}
+
+func (r *runReport) encode(output io.Writer, format ReportFormat) error {
+	if format == YAMLReportFormat {
+		encoder := yaml.NewEncoder(output)
+
+		err := encoder.Encode(r)
+		if err != nil {
+			return err
+		}
+
+		return encoder.Close()
+	}
+
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(r)
+}
@@ -0,0 +1,229 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/FirinKinuo/capyback/application"
+	"github.com/FirinKinuo/capyback/archive"
+	"github.com/FirinKinuo/capyback/cli/flag"
+	"github.com/FirinKinuo/capyback/config"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/index"
+	"github.com/FirinKinuo/capyback/pipe"
+	"github.com/FirinKinuo/capyback/storage"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Restore is a command for restore a backup from storage.
+type Restore struct {
+	command   *cobra.Command
+	appConfig *config.Config
+
+	backupName string
+	target     string
+
+	storageFlagSet    *flag.StorageFlagSet
+	configFlagSet     *flag.ConfigFlagSet
+	encryptionFlagSet *flag.EncryptionFlagSet
+	repositoryFlagSet *flag.RepositoryFlagSet
+
+	storager  storage.Storager
+	decrypter crypt.Decrypter
+}
+
+// NewRestore creates a new Restore.
+func NewRestore(defaultConfigPath string) *Restore {
+	restore := &Restore{
+		storageFlagSet:    flag.NewStorageFlagSet(),
+		configFlagSet:     flag.NewConfigFlagSet(defaultConfigPath),
+		encryptionFlagSet: flag.NewEncryptionFlagSet(),
+		repositoryFlagSet: flag.NewRepositoryFlagSet(),
+	}
+
+	command := &cobra.Command{
+		Use:   "restore BACKUP",
+		Short: "Restore backup from storage",
+		Args:  cobra.ExactArgs(1),
+		RunE:  restore.run,
+	}
+
+	command.PersistentFlags().AddFlagSet(restore.FlagSet())
+
+	restore.command = command
+
+	return restore
+}
+
+// FlagSet returns a flag set for restore command.
+func (r *Restore) FlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("restore", pflag.PanicOnError)
+
+	flagSet.StringVarP(&r.target, "target", "t", ".", "directory to extract the backup into")
+
+	flagSet.AddFlagSet(r.storageFlagSet.FlagSet())
+	flagSet.AddFlagSet(r.configFlagSet.FlagSet())
+	flagSet.AddFlagSet(r.repositoryFlagSet.FlagSet())
+	flagSet.AddFlagSet(r.encryptionFlagSet.DecryptFlagSet())
+
+	return flagSet
+}
+
+func (r *Restore) Command() *cobra.Command {
+	return r.command
+}
+
+// configure configures the restore command from flag sets.
+func (r *Restore) configure(args []string) error {
+	r.backupName = args[0]
+
+	var err error
+	r.appConfig, err = readConfig(r.configFlagSet, r.storageFlagSet, r.repositoryFlagSet)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	// Encrypted backup name ends with an encryption suffix after the archive format
+	_, err = archive.IdentifyArchiver(crypt.TrimSuffix(r.backupName))
+	if err != nil {
+		return fmt.Errorf("identify archiver: %w", err)
+	}
+
+	r.encryptionFlagSet.Apply(&r.appConfig.Encryption)
+
+	if crypt.IsEncrypted(r.backupName) {
+		r.decrypter, err = r.appConfig.Encryption.ReadDecrypter()
+		if err != nil {
+			return fmt.Errorf("read decrypter: %w", err)
+		}
+	} else {
+		// Parents of an incremental backup may be encrypted, even if the backup is not
+		r.decrypter, err = readOptionalDecrypter(&r.appConfig.Encryption)
+		if err != nil {
+			return err
+		}
+	}
+
+	backupStorage, err := readStorage(r.appConfig, &r.appConfig.Storage, nil, r.decrypter)
+	if err != nil {
+		return fmt.Errorf("read storager: %w", err)
+	}
+
+	r.storager = backupStorage
+
+	return nil
+}
+
+// performRestore restores the backup, an incremental backup is restored with its chain from the full backup.
+func (r *Restore) performRestore(ctx context.Context) error {
+	err := r.storager.Authenticate(ctx)
+	if err != nil {
+		return fmt.Errorf("authenticate storage: %w", err)
+	}
+
+	chain, err := r.readChain(ctx)
+	if err != nil {
+		return fmt.Errorf("read incremental chain: %w", err)
+	}
+
+	if chain == nil {
+		return r.restoreBackup(ctx, r.backupName)
+	}
+
+	if len(chain) > 1 {
+		log.Info("Restore incremental chain", "backups", len(chain), "full", chain[0].Backup)
+	}
+
+	for _, backupIndex := range chain {
+		err = r.restoreBackup(ctx, backupIndex.Backup)
+		if err != nil {
+			return fmt.Errorf("%s: %w", backupIndex.Backup, err)
+		}
+
+		err = backupIndex.ApplyDeletions(r.target)
+		if err != nil {
+			return fmt.Errorf("%s: apply deletions: %w", backupIndex.Backup, err)
+		}
+	}
+
+	return nil
+}
+
+// readChain reads indexes of the backup and its parents, or returns nil if the backup has no index.
+func (r *Restore) readChain(ctx context.Context) ([]*index.Index, error) {
+	indexes := application.NewIndexes(r.storager)
+	if r.decrypter != nil {
+		indexes.SetDecrypter(r.decrypter)
+	}
+
+	objectParams, err := r.appConfig.Storage.ReadObjectParams()
+	if err != nil {
+		return nil, fmt.Errorf("read object params: %w", err)
+	}
+
+	return indexes.Chain(ctx, objectParams, r.backupName)
+}
+
+// restoreBackup reads one backup from the storage and extracts it into the target.
+func (r *Restore) restoreBackup(ctx context.Context, backupName string) error {
+	log.Infof("Restore backup: %s", backupName)
+
+	archiver, err := archive.IdentifyArchiver(crypt.TrimSuffix(backupName))
+	if err != nil {
+		return fmt.Errorf("identify archiver: %w", err)
+	}
+
+	inMemoryPipe, err := pipe.NewPipe(pipe.InMemoryPipeType)
+	if err != nil {
+		return fmt.Errorf("create new pipe: %w", err)
+	}
+	defer func() {
+		inMemoryPipe.CloseWrite()
+		inMemoryPipe.CloseRead()
+	}()
+
+	restore := application.NewRestore(inMemoryPipe, r.storager, archiver)
+	if crypt.IsEncrypted(backupName) {
+		if r.decrypter == nil {
+			return crypt.ErrorNoIdentities
+		}
+
+		restore.SetDecrypter(r.decrypter)
+	}
+
+	objectParams, err := r.appConfig.Storage.ReadObjectParams()
+	if err != nil {
+		return fmt.Errorf("read object params: %w", err)
+	}
+	objectParams.SetName(backupName)
+
+	err = restore.Restore(ctx, objectParams, r.target)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Restore) run(_ *cobra.Command, args []string) error {
+	err := r.configure(args)
+	if err != nil {
+		return configError(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = r.performRestore(ctx)
+	if err != nil {
+		return performError(ctx, "perform restore", err)
+	}
+
+	return nil
+}
@@ -4,15 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/FirinKinuo/capyback/application"
 	"github.com/FirinKinuo/capyback/archive"
+	"github.com/FirinKinuo/capyback/bytesize"
 	"github.com/FirinKinuo/capyback/cli/flag"
 	"github.com/FirinKinuo/capyback/config"
-	"github.com/FirinKinuo/capyback/pipe"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/hook"
+	"github.com/FirinKinuo/capyback/index"
+	"github.com/FirinKinuo/capyback/naming"
+	"github.com/FirinKinuo/capyback/progress"
+	"github.com/FirinKinuo/capyback/repository"
+	"github.com/FirinKinuo/capyback/shell"
 	"github.com/FirinKinuo/capyback/storage"
 
 	"github.com/charmbracelet/log"
@@ -29,35 +43,133 @@ var ErrorMultipleFilesWithoutName = errors.New(
 // ErrorNoResourcesToBackup is an error when no resources were specified for backup.
 var ErrorNoResourcesToBackup = errors.New("resources for backup were not specified")
 
+// ErrorResourcesWithJob is an error when resources are specified together with jobs.
+var ErrorResourcesWithJob = errors.New("resources can not be specified together with jobs")
+
+// ErrorNameWithMultipleJobs is an error when one backup name is specified for several jobs.
+var ErrorNameWithMultipleJobs = errors.New("backup name can not be specified for several jobs")
+
+// ErrorIncrementalWithoutIdentity is an error when an encrypted incremental backup can not read the previous index.
+var ErrorIncrementalWithoutIdentity = errors.New(
+	"encrypted incremental backup requires an identity or a passphrase to read the previous index, " +
+		"set --identity-file, --passphrase-file, CAPYBACK_PASSPHRASE or the encryption config",
+)
+
+// ErrorIncrementalSameName is an error when an incremental backup would replace its parent backup.
+var ErrorIncrementalSameName = errors.New(
+	"incremental backup would replace the previous backup, use a name template like \"backup-{time}\"",
+)
+
+// ErrorStreamWithResources is an error when stdin or a command is backed up together with other resources.
+var ErrorStreamWithResources = errors.New("stdin or a command can not be backed up together with other resources")
+
+// ErrorStreamWithoutName is an error when stdin or a command is backed up without backup name.
+var ErrorStreamWithoutName = errors.New("backup name is required when backing up stdin or a command")
+
+// ErrorIncrementalStream is an error when an incremental backup of stdin or a command is requested.
+var ErrorIncrementalStream = errors.New("incremental backup of stdin or a command is not supported")
+
+// StdinResource is a resource, which backs up stdin.
+const StdinResource = "-"
+
 // Save is a command for save new backup to storage.
 type Save struct {
 	command   *cobra.Command
 	appConfig *config.Config
 
+	version string
+
+	jobNames    []string
+	backupName  string
+	fromCommand string
+	streamName  string
+	prune       bool
+	incremental bool
+	full        bool
+	dryRun      bool
+
+	progressMode     progress.Mode
+	progressInterval time.Duration
+
+	reportFormat ReportFormat
+	reportFile   string
+	report       *runReport
+
+	// nameVariables are shared by all jobs of the run, so their names have the same time and id.
+	nameVariables naming.Variables
+
+	storageFlagSet    *flag.StorageFlagSet
+	configFlagSet     *flag.ConfigFlagSet
+	archiveFlagSet    *flag.ArchiveFlagSet
+	encryptionFlagSet *flag.EncryptionFlagSet
+	repositoryFlagSet *flag.RepositoryFlagSet
+	filterFlagSet     *flag.FilterFlagSet
+	pipeFlagSet       *flag.PipeFlagSet
+
+	tasks []*saveTask
+}
+
+// saveTask is a backup of one job resolved from the config and flags.
+type saveTask struct {
+	jobName    string
 	resources  []string
 	backupName string
 
-	storageFlagSet *flag.StorageFlagSet
-	configFlagSet  *flag.ConfigFlagSet
-	archiveFlagSet *flag.ArchiveFlagSet
+	// command is a shell command, whose output is backed up as a file named streamName.
+	// Stdin is backed up the same way, when it is the only resource.
+	command    string
+	streamName string
+
+	storageConfig *storage.Config
+
+	storager  storage.Storager
+	archiver  archive.Archiver
+	encrypter crypt.Encrypter
 
-	storager storage.Storager
-	archiver archive.Archiver
+	// hooks are run around the backup, it is nil when there are no hooks.
+	hooks *hook.Runner
+
+	progress *progress.Tracker
+
+	// repository is set when the backup is stored in the deduplicated repository, which encrypts objects itself.
+	repository bool
+
+	// index is set for incremental backups, the decrypter reads the previous index, if it is encrypted.
+	series    string
+	index     *index.Builder
+	decrypter crypt.Decrypter
 }
 
 // NewSave creates a new Save.
 func NewSave(defaultConfigPath string) *Save {
-	save := &Save{
-		storageFlagSet: flag.NewStorageFlagSet(),
-		configFlagSet:  flag.NewConfigFlagSet(defaultConfigPath),
-		archiveFlagSet: flag.NewArchiveFlagSet(archive.DefaultFormat),
-	}
+	save := newSave(defaultConfigPath)
 
 	command := &cobra.Command{
-		Use:   "save [FILE/DIR...]",
+		Use:   "save [FILE/DIR... | -]",
 		Short: "Save new backup",
+		Args:  save.validateArgs,
+		RunE:  save.run,
+	}
+
+	command.PersistentFlags().AddFlagSet(save.FlagSet())
+
+	save.command = command
+
+	return save
+}
+
+// NewRun creates a new Save, which runs jobs from the config passed as arguments.
+func NewRun(defaultConfigPath string) *Save {
+	save := newSave(defaultConfigPath)
+
+	command := &cobra.Command{
+		Use:   "run JOB...",
+		Short: "Run backup jobs from config",
 		Args:  cobra.MinimumNArgs(1),
-		Run:   save.run,
+		RunE: func(command *cobra.Command, args []string) error {
+			save.jobNames = append(save.jobNames, args...)
+			return save.run(command, nil)
+		},
 	}
 
 	command.PersistentFlags().AddFlagSet(save.FlagSet())
@@ -67,6 +179,28 @@ func NewSave(defaultConfigPath string) *Save {
 	return save
 }
 
+// validateArgs requires resources to back up, unless jobs or a command are backed up.
+func (s *Save) validateArgs(_ *cobra.Command, args []string) error {
+	if len(args) == 0 && len(s.jobNames) == 0 && s.fromCommand == "" {
+		return ErrorNoResourcesToBackup
+	}
+
+	return nil
+}
+
+func newSave(defaultConfigPath string) *Save {
+	return &Save{
+		progressMode:      progress.AutoMode,
+		storageFlagSet:    flag.NewStorageFlagSet(),
+		configFlagSet:     flag.NewConfigFlagSet(defaultConfigPath),
+		archiveFlagSet:    flag.NewArchiveFlagSet(archive.DefaultFormat),
+		encryptionFlagSet: flag.NewEncryptionFlagSet(),
+		repositoryFlagSet: flag.NewRepositoryFlagSet(),
+		filterFlagSet:     flag.NewFilterFlagSet(),
+		pipeFlagSet:       flag.NewPipeFlagSet(),
+	}
+}
+
 // FlagSet returns a flag set for save command.
 func (s *Save) FlagSet() *pflag.FlagSet {
 	flagSet := pflag.NewFlagSet("save", pflag.PanicOnError)
@@ -76,12 +210,75 @@ func (s *Save) FlagSet() *pflag.FlagSet {
 		"name",
 		"o",
 		"",
-		"backup name, example: \"my-backup@01.02.2006.tar.zst\". Required when handling more than one file or directory.",
+		"backup name template without format, example: \"my-backup@{time:2006-01-02T15-04-05}\" or \"{hostname}-%Y%m%d-{id}\". "+
+			"Placeholders: {time[:LAYOUT]}, {utc[:LAYOUT]}, {hostname}, {job}, {user}, {id} and strftime directives. "+
+			"Required when handling more than one file or directory.",
+	)
+
+	flagSet.StringArrayVarP(&s.jobNames, "job", "j", nil, "run job from config instead of resources. Can be repeated")
+
+	flagSet.StringVar(
+		&s.fromCommand,
+		"from-command",
+		"",
+		"back up output of the shell command instead of resources, example: \"pg_dump mydb\". "+
+			"Use \"-\" as the resource to back up stdin",
+	)
+	flagSet.StringVar(
+		&s.streamName,
+		"stream-name",
+		"",
+		"file name of the command output or stdin in an archive, default: backup name. "+
+			"Compression formats like \"zst\" store the stream without an archive and a temporary file",
+	)
+
+	flagSet.BoolVar(&s.prune, "prune", false, "remove old backups according to retention policies after successful save")
+	flagSet.BoolVar(
+		&s.incremental,
+		"incremental",
+		false,
+		"archive only files changed since the previous backup of the same resources or job",
+	)
+	flagSet.BoolVar(&s.full, "full", false, "archive all files of an incremental backup, starting a new chain")
+	flagSet.BoolVarP(
+		&s.dryRun,
+		"dry-run",
+		"n",
+		false,
+		"only show the backup name and files, which would be archived, and check the storage without writing anything",
+	)
+
+	flagSet.Var(
+		&s.progressMode,
+		"progress",
+		"progress reporting: auto, bar, log or none, auto renders a bar on a terminal and logs progress lines otherwise",
+	)
+	flagSet.DurationVar(
+		&s.progressInterval,
+		"progress-interval",
+		progress.DefaultLogInterval,
+		"interval of logged progress lines",
+	)
+
+	flagSet.Var(
+		&s.reportFormat,
+		"report",
+		"write a report of backups of the run: json or yaml, to stdout unless a report file is set",
+	)
+	flagSet.StringVar(
+		&s.reportFile,
+		"report-file",
+		"",
+		"write the report of the run to the file, the format is chosen by the extension unless --report is set",
 	)
 
 	flagSet.AddFlagSet(s.storageFlagSet.FlagSet())
 	flagSet.AddFlagSet(s.configFlagSet.FlagSet())
+	flagSet.AddFlagSet(s.repositoryFlagSet.FlagSet())
 	flagSet.AddFlagSet(s.archiveFlagSet.FlagSet())
+	flagSet.AddFlagSet(s.encryptionFlagSet.EncryptFlagSet())
+	flagSet.AddFlagSet(s.filterFlagSet.FlagSet())
+	flagSet.AddFlagSet(s.pipeFlagSet.FlagSet())
 
 	return flagSet
 }
@@ -90,111 +287,667 @@ func (s *Save) Command() *cobra.Command {
 	return s.command
 }
 
-func (s *Save) validateBackupName() error {
-	if len(s.resources) > 1 && s.backupName == "" {
+func (s *Save) validateBackupName(task *saveTask) error {
+	if task.isStream() && task.backupName == "" {
+		return ErrorStreamWithoutName
+	}
+
+	if len(task.resources) > 1 && task.backupName == "" {
 		return ErrorMultipleFilesWithoutName
 	}
 
 	return nil
 }
 
-func (s *Save) configureBackupName() error {
-	// If there is only one resource for backup and the name was not set with a flag
+// resourceName returns the base name of the resource, so a backup of an absolute path or of "." is named after the directory.
+func resourceName(resource string) string {
+	absolutePath, err := filepath.Abs(resource)
+	if err != nil {
+		return filepath.Base(resource)
+	}
+
+	return filepath.Base(absolutePath)
+}
+
+func (s *Save) configureBackupName(task *saveTask, job *config.Job) error {
+	task.backupName = job.Name
+
+	// If there is only one resource for backup and the name was not set
 	// Then we use the name of the resource itself as the backup name
-	if len(s.resources) == 1 && s.backupName == "" {
-		s.backupName = s.resources[0]
+	if len(task.resources) == 1 && task.backupName == "" && !task.isStream() {
+		task.backupName = resourceName(task.resources[0])
 	}
 
-	err := s.validateBackupName()
+	err := s.validateBackupName(task)
 	if err != nil {
 		return fmt.Errorf("validate backupName: %w", err)
 	}
 
-	s.backupName = fmt.Sprintf("%s.%s", s.backupName, s.archiveFlagSet.Format)
+	if job.Name != "" {
+		variables := s.nameVariables
+		variables.Job = task.jobName
+
+		task.backupName, err = naming.Expand(job.Name, variables)
+		if err != nil {
+			return fmt.Errorf("expand backupName template: %w", err)
+		}
+	}
+
+	// The stream is archived as a file named after the backup, unless its name is set
+	if task.isStream() && task.streamName == "" {
+		task.streamName = path.Base(task.backupName)
+	}
+
+	task.backupName = fmt.Sprintf("%s.%s", task.backupName, job.Format)
 
 	return nil
 }
 
+// pruneAfterSave reports whether backups are pruned after a successful save, by the flag or by the config.
+func (s *Save) pruneAfterSave() bool {
+	return s.prune || s.appConfig.Retention.PruneAfterSave
+}
+
 // configure configures the save command from flag sets.
 func (s *Save) configure(args []string) error {
-	s.resources = args
+	var err error
+	s.appConfig, err = readConfig(s.configFlagSet, s.storageFlagSet, s.repositoryFlagSet)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
 
-	if len(s.resources) < 1 {
-		return ErrorNoResourcesToBackup
+	s.encryptionFlagSet.Apply(&s.appConfig.Encryption)
+	s.pipeFlagSet.Apply(&s.appConfig.Pipe)
+	s.nameVariables = naming.NewVariables("")
+
+	if s.pruneAfterSave() && len(s.appConfig.Retention.Policies) == 0 {
+		return ErrorNoRetentionPolicies
+	}
+
+	if len(s.jobNames) == 0 {
+		task, err := s.configureTask("", &config.Job{
+			Resources:   args,
+			Command:     s.fromCommand,
+			StreamName:  s.streamName,
+			Name:        s.backupName,
+			Incremental: s.incremental,
+		})
+		if err != nil {
+			return err
+		}
+
+		s.tasks = append(s.tasks, task)
+
+		return nil
+	}
+
+	if len(args) > 0 || s.fromCommand != "" {
+		return ErrorResourcesWithJob
+	}
+
+	if len(s.jobNames) > 1 && s.backupName != "" {
+		return ErrorNameWithMultipleJobs
+	}
+
+	for _, jobName := range s.jobNames {
+		job, err := s.appConfig.Job(jobName)
+		if err != nil {
+			return fmt.Errorf("read job: %w", err)
+		}
+
+		if s.backupName != "" {
+			job.Name = s.backupName
+		}
+
+		if s.streamName != "" {
+			job.StreamName = s.streamName
+		}
+
+		job.Incremental = job.Incremental || s.incremental
+
+		task, err := s.configureTask(jobName, &job)
+		if err != nil {
+			return fmt.Errorf("configure job %s: %w", jobName, err)
+		}
+
+		s.tasks = append(s.tasks, task)
+	}
+
+	return nil
+}
+
+// configureTask resolves the job with the config and flags into a task.
+func (s *Save) configureTask(jobName string, job *config.Job) (*saveTask, error) {
+	task := &saveTask{
+		jobName:    jobName,
+		resources:  job.Resources,
+		command:    job.Command,
+		streamName: job.StreamName,
+		repository: s.appConfig.Repository.Enabled,
+		progress:   progress.NewTracker(),
+	}
+
+	if len(task.resources) < 1 && task.command == "" {
+		return nil, ErrorNoResourcesToBackup
+	}
+
+	err := s.validateStream(task, job)
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunks of the repository are compressed, an uncompressed archive keeps unchanged files in the same chunks
+	if job.Format == "" && task.repository {
+		job.Format = repository.DefaultFormat
 	}
 
-	err := s.configureBackupName()
+	s.archiveFlagSet.ApplyFormat(&job.Format)
+
+	err = s.configureBackupName(task, job)
 	if err != nil {
-		return fmt.Errorf("configure backupName: %w", err)
+		return nil, fmt.Errorf("configure backupName: %w", err)
 	}
 
-	if s.configFlagSet.Path != "" {
-		s.appConfig, err = s.configFlagSet.ReadYamlConfig()
+	filterConfig := s.appConfig.Filter.Extend(job.Filter)
+	s.filterFlagSet.Apply(&filterConfig)
+
+	fileFilter, err := filterConfig.ReadFilter()
+	if err != nil {
+		return nil, fmt.Errorf("read filter: %w", err)
+	}
+
+	err = s.configureEncryption(task)
+	if err != nil {
+		return nil, fmt.Errorf("configure encryption: %w", err)
+	}
+
+	s.configureHooks(task, job)
+
+	archiveOptions := []archive.Option{
+		archive.WithFilter(fileFilter),
+		archive.WithProgress(task.progress),
+		archive.WithSpool(s.appConfig.Pipe.Directory, int64(s.appConfig.Pipe.MaxSize)),
+	}
+
+	if job.Incremental {
+		err = s.configureIndex(task)
 		if err != nil {
-			return fmt.Errorf("read yaml config: %w", err)
+			return nil, fmt.Errorf("configure index: %w", err)
 		}
+
+		archiveOptions = append(archiveOptions, archive.WithIndex(task.index))
+	}
+
+	// Encrypted backup name ends with an encryption suffix after the archive format
+	task.archiver, err = archive.IdentifyArchiver(crypt.TrimSuffix(task.backupName), archiveOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("identify archiver: %w", err)
 	}
 
-	s.archiver, err = archive.IdentifyArchiver(s.backupName)
+	task.storageConfig, err = s.configureStorage(job)
 	if err != nil {
-		return fmt.Errorf("identify archiver: %w", err)
+		return nil, fmt.Errorf("configure storage: %w", err)
 	}
 
-	backupStorage, err := s.appConfig.Storage.ReadStorage()
+	task.storager, err = readStorage(s.appConfig, task.storageConfig, task.repositoryEncrypter(), task.decrypter)
 	if err != nil {
-		return fmt.Errorf("read storager: %w", err)
+		return nil, fmt.Errorf("read storager: %w", err)
+	}
+
+	return task, nil
+}
+
+// validateStream checks that stdin or a command is the only resource of the task.
+func (s *Save) validateStream(task *saveTask, job *config.Job) error {
+	if task.command != "" && len(task.resources) > 0 {
+		return ErrorStreamWithResources
 	}
 
-	s.storager = backupStorage
+	if slices.Contains(task.resources, StdinResource) && len(task.resources) > 1 {
+		return ErrorStreamWithResources
+	}
+
+	if task.isStream() && job.Incremental {
+		return ErrorIncrementalStream
+	}
 
 	return nil
 }
 
-func (s *Save) performBackup(ctx context.Context) error {
-	inMemoryPipe, err := pipe.NewPipe(pipe.InMemoryPipeType)
+// isStream reports whether the task backs up output of a command or stdin instead of files.
+func (t *saveTask) isStream() bool {
+	return t.command != "" || (len(t.resources) == 1 && t.resources[0] == StdinResource)
+}
+
+// sources returns resources of the task, or the command, whose output is backed up.
+func (t *saveTask) sources() []string {
+	if t.command != "" {
+		return []string{t.command}
+	}
+
+	return t.resources
+}
+
+// openStream starts the command and returns its output, or returns stdin, if there is no command.
+func (t *saveTask) openStream(ctx context.Context) (io.ReadCloser, error) {
+	if t.command == "" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	log.Info("Run command", "command", t.command)
+
+	output, err := shell.StartOutput(ctx, t.command)
 	if err != nil {
-		log.Fatal("create new pipe", "err", err)
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// configureHooks prepares hooks of the config and the job, which know the job and its resources.
+func (s *Save) configureHooks(task *saveTask, job *config.Job) {
+	hooksConfig := s.appConfig.Hooks.Extend(job.Hooks)
+	if hooksConfig.Empty() {
+		return
+	}
+
+	task.hooks = hook.NewRunner(hooksConfig)
+	task.hooks.SetEnv(hook.EnvJob, task.jobName)
+	task.hooks.SetEnv(hook.EnvResources, strings.Join(task.sources(), ","))
+}
+
+// configureIndex prepares the index of an incremental backup.
+// Backups of a job are chained by the job name, other backups by their resources.
+func (s *Save) configureIndex(task *saveTask) error {
+	task.series = "job:" + task.jobName
+
+	if task.jobName == "" {
+		resources := make([]string, 0, len(task.resources))
+
+		for _, resource := range task.resources {
+			absResource, err := filepath.Abs(resource)
+			if err != nil {
+				return fmt.Errorf("resolve resource: %w", err)
+			}
+
+			resources = append(resources, absResource)
+		}
+
+		sort.Strings(resources)
+		task.series = "resources:" + strings.Join(resources, ",")
+	}
+
+	task.index = index.NewBuilder(task.series, task.backupName)
+
+	if task.encrypter == nil || s.full {
+		return nil
+	}
+
+	// The previous index is encrypted too, so it can not be read with recipients only
+	decrypter, err := readOptionalDecrypter(&s.appConfig.Encryption)
+	if err != nil {
+		return err
+	}
+
+	if decrypter == nil {
+		return ErrorIncrementalWithoutIdentity
+	}
+
+	task.decrypter = decrypter
+
+	return nil
+}
+
+// configureStorage returns the storage of the job layered with environment and flags,
+// or the storage of the config if the job does not replace it.
+func (s *Save) configureStorage(job *config.Job) (*storage.Config, error) {
+	if job.Storage == nil {
+		return &s.appConfig.Storage, nil
+	}
+
+	storageConfig, err := job.Storage.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = storageConfig.ReadFromEnviron()
+	if err != nil {
+		return nil, fmt.Errorf("read environ: %w", err)
+	}
+
+	err = s.storageFlagSet.Apply(storageConfig)
+	if err != nil {
+		return nil, fmt.Errorf("apply storage flags: %w", err)
+	}
+
+	return storageConfig, nil
+}
+
+// configureEncryption reads the encrypter and marks the backup name as encrypted, if encryption is enabled.
+func (s *Save) configureEncryption(task *saveTask) error {
+	if !s.appConfig.Encryption.EncryptionEnabled() {
+		return nil
+	}
+
+	encrypter, err := s.appConfig.Encryption.ReadEncrypter()
+	if err != nil {
+		return fmt.Errorf("read encrypter: %w", err)
+	}
+
+	task.encrypter = encrypter
+
+	// The repository encrypts its objects itself, so the backup is stored under its name
+	if task.repository {
+		return nil
+	}
+
+	task.backupName += crypt.Suffix
+
+	return nil
+}
+
+// repositoryEncrypter returns the encrypter of objects of the repository, or nil if the backup is not in the repository.
+func (t *saveTask) repositoryEncrypter() crypt.Encrypter {
+	if !t.repository {
+		return nil
+	}
+
+	return t.encrypter
+}
+
+// backupEncrypter returns the encrypter of the backup stream, or nil if the repository encrypts it.
+func (t *saveTask) backupEncrypter() crypt.Encrypter {
+	if t.repository {
+		return nil
+	}
+
+	return t.encrypter
+}
+
+func (s *Save) performBackup(ctx context.Context, task *saveTask) (*application.BackupResult, error) {
+	backupPipe, err := s.appConfig.Pipe.ReadPipe()
+	if err != nil {
+		return nil, fmt.Errorf("create new pipe: %w", err)
 	}
 	defer func() {
-		inMemoryPipe.CloseWrite()
-		inMemoryPipe.CloseRead()
+		backupPipe.CloseWrite()
+		backupPipe.CloseRead()
 	}()
 
-	backup := application.NewBackup(inMemoryPipe, s.storager, s.archiver)
+	backup := application.NewBackup(backupPipe, task.storager, task.archiver)
+	backup.SetProgress(task.progress)
+	if encrypter := task.backupEncrypter(); encrypter != nil {
+		backup.SetEncrypter(encrypter)
+	}
+	if task.hooks != nil {
+		backup.SetHooks(task.hooks)
+	}
+
+	writeParams, err := task.storageConfig.ReadWriteParams()
+	if err != nil {
+		return nil, fmt.Errorf("read write params: %w", err)
+	}
+	writeParams.SetName(task.backupName)
+	writeParams.SetMetadata(s.backupMetadata(task))
+
+	var indexes *application.Indexes
+	if task.index != nil {
+		indexes, err = s.prepareIndex(ctx, task)
+		if err != nil {
+			return nil, fmt.Errorf("prepare index: %w", err)
+		}
+	}
+
+	reporter := progress.NewReporter(task.progress, s.progressMode, s.progressInterval)
+	reporter.Start()
+
+	var result *application.BackupResult
+	if task.isStream() {
+		result, err = backup.SaveStream(ctx, task.openStream, task.streamName, writeParams)
+	} else {
+		result, err = backup.Save(ctx, task.resources, writeParams)
+	}
+
+	reporter.Stop()
+
+	if err != nil {
+		// The result is returned with the error, when the backup is written, but hooks after it failed
+		return result, fmt.Errorf("backup save: %w", err)
+	}
+
+	if indexes != nil {
+		indexWriteParams, err := task.storageConfig.ReadWriteParams()
+		if err != nil {
+			return result, fmt.Errorf("read index write params: %w", err)
+		}
+
+		err = indexes.Write(ctx, task.index.Index(), indexWriteParams)
+		if err != nil {
+			return result, fmt.Errorf("write index: %w", err)
+		}
+	}
+
+	if s.pruneAfterSave() {
+		err = performPrune(ctx, task.storager, task.decrypter, task.storageConfig, s.appConfig.Retention.Policies, false)
+		if err != nil {
+			return result, fmt.Errorf("prune after save: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// performDryRun reports what the backup of the task would do without writing anything.
+// The storage is authenticated and read, hooks and the command of a stream are not run.
+func (s *Save) performDryRun(ctx context.Context, task *saveTask) error {
+	log.Info(
+		"Dry run",
+		"name", task.backupName,
+		"storage", task.storageConfig.StorageType,
+		"format", task.archiver.Format(),
+		"encrypted", task.encrypter != nil,
+		"repository", task.repository,
+	)
 
-	writeParams, err := s.appConfig.Storage.ReadWriteParams()
+	log.Info("Attempting to authenticate to storage")
+	err := task.storager.Authenticate(ctx)
 	if err != nil {
-		return fmt.Errorf("read write params: %w", err)
+		return fmt.Errorf("authenticate storage: %w", err)
+	}
+
+	log.Info("Authentication to storage succeeded.")
+
+	// The previous index is read, so only files changed since the previous backup are reported
+	if task.index != nil {
+		_, err = s.prepareIndex(ctx, task)
+		if err != nil {
+			return fmt.Errorf("prepare index: %w", err)
+		}
+	}
+
+	if task.isStream() {
+		log.Info("Would back up a stream", "source", strings.Join(task.sources(), ","), "stream-name", task.streamName)
+	} else {
+		summary, err := task.archiver.Scan(ctx, task.resources)
+		if err != nil {
+			return fmt.Errorf("scan resources: %w", err)
+		}
+
+		log.Info("Would archive", "entries", summary.Entries, "files", summary.Files, "size", bytesize.Size(summary.Size))
 	}
-	writeParams.SetName(s.backupName)
 
-	err = backup.Save(ctx, s.resources, writeParams)
+	objectParams, err := task.storageConfig.ReadObjectParams()
 	if err != nil {
-		return fmt.Errorf("backup save: %w", err)
+		return fmt.Errorf("read object params: %w", err)
+	}
+	objectParams.SetName(task.backupName)
+
+	_, err = task.storager.Stat(ctx, objectParams)
+	switch {
+	case err == nil:
+		log.Warn("Backup exists and would be replaced", "name", task.backupName)
+	case !errors.Is(err, storage.ErrorObjectNotFound):
+		return fmt.Errorf("stat backup: %w", err)
+	}
+
+	if task.hooks != nil {
+		log.Info("Hooks are not run in a dry run")
+	}
+
+	if s.pruneAfterSave() {
+		err = performPrune(ctx, task.storager, task.decrypter, task.storageConfig, s.appConfig.Retention.Policies, true)
+		if err != nil {
+			return fmt.Errorf("prune after save: %w", err)
+		}
 	}
 
 	return nil
 }
 
-func (s *Save) run(_ *cobra.Command, args []string) {
-	err := s.configure(args)
+// prepareIndex makes the index incremental to the latest index of the series, unless a full backup is requested.
+func (s *Save) prepareIndex(ctx context.Context, task *saveTask) (*application.Indexes, error) {
+	indexes := application.NewIndexes(task.storager)
+	if encrypter := task.backupEncrypter(); encrypter != nil {
+		indexes.SetEncrypter(encrypter)
+	}
+	if task.decrypter != nil {
+		indexes.SetDecrypter(task.decrypter)
+	}
+
+	if s.full {
+		log.Info("Full backup requested, start a new incremental chain")
+		return indexes, nil
+	}
+
+	err := task.storager.Authenticate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate storage: %w", err)
+	}
+
+	listParams, err := task.storageConfig.ReadListParams()
+	if err != nil {
+		return nil, fmt.Errorf("read list params: %w", err)
+	}
+
+	objectParams, err := task.storageConfig.ReadObjectParams()
 	if err != nil {
-		log.Fatal("configure", "err", err)
+		return nil, fmt.Errorf("read object params: %w", err)
 	}
 
-	log.Infof("Create new backup: %s", s.backupName)
+	parent, err := indexes.Latest(ctx, listParams, objectParams, task.series)
+	if err != nil {
+		return nil, fmt.Errorf("find previous index: %w", err)
+	}
+
+	if parent == nil {
+		log.Info("No previous backup, start a new incremental chain")
+		return indexes, nil
+	}
+
+	if parent.Backup == task.backupName {
+		return nil, ErrorIncrementalSameName
+	}
+
+	log.Info("Incremental backup", "parent", parent.Backup)
+	task.index.SetParent(parent)
+
+	return indexes, nil
+}
+
+// backupMetadata returns metadata, which describes the backup of the task.
+func (s *Save) backupMetadata(task *saveTask) map[string]string {
+	metadata := map[string]string{
+		storage.MetadataHost:      s.nameVariables.Hostname,
+		storage.MetadataResources: strings.Join(task.sources(), ","),
+		storage.MetadataFormat:    task.archiver.Format(),
+		storage.MetadataVersion:   s.version,
+	}
+
+	if task.encrypter != nil {
+		metadata[storage.MetadataEncryption] = crypt.Format
+	}
+
+	return metadata
+}
+
+// performTasks runs all tasks, a failed task does not stop the rest.
+// When some backups are written, but other tasks or steps after the backups failed, the error is ErrorPartialSuccess.
+func (s *Save) performTasks(ctx context.Context) error {
+	var taskErrors []error
+	written := false
+
+	for _, task := range s.tasks {
+		if task.jobName != "" {
+			log.Infof("Run job: %s", task.jobName)
+		}
+
+		started := time.Now()
+
+		var result *application.BackupResult
+		var err error
+		if s.dryRun {
+			err = s.performDryRun(ctx, task)
+		} else {
+			log.Infof("Create new backup: %s", task.backupName)
+			result, err = s.performBackup(ctx, task)
+		}
+
+		s.report.Backups = append(s.report.Backups, newBackupReport(task, result, time.Since(started), err))
+
+		if result != nil {
+			written = true
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+
+		if task.jobName != "" {
+			err = fmt.Errorf("job %s: %w", task.jobName, err)
+		}
+
+		log.Error("perform backup", "err", err)
+		taskErrors = append(taskErrors, err)
+	}
+
+	if len(taskErrors) > 0 && written {
+		return fmt.Errorf("%w: %w", ErrorPartialSuccess, errors.Join(taskErrors...))
+	}
+
+	return errors.Join(taskErrors...)
+}
+
+func (s *Save) run(command *cobra.Command, args []string) error {
+	s.version = command.Root().Version
+
+	err := s.configure(args)
+	if err != nil {
+		return configError(err)
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	err = s.performBackup(ctx)
-	if err != nil {
-		select {
-		case <-ctx.Done():
-			log.Info("Backup cancelled")
+	s.report = &runReport{Version: s.version, Host: s.nameVariables.Hostname, Started: time.Now(), DryRun: s.dryRun}
+
+	err = s.performTasks(ctx)
 
-		default:
-			log.Fatal("perform backup", "err", err)
+	s.report.finish(ctx.Err() != nil)
+
+	if s.reportFormat != "" || s.reportFile != "" {
+		reportErr := s.report.write(s.reportFormat, s.reportFile)
+		if reportErr != nil {
+			log.Error("write report", "err", reportErr)
 		}
 	}
+
+	if err != nil {
+		return performError(ctx, "perform backup", err)
+	}
+
+	return nil
 }
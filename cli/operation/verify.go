@@ -0,0 +1,199 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/FirinKinuo/capyback/application"
+	"github.com/FirinKinuo/capyback/archive"
+	"github.com/FirinKinuo/capyback/bytesize"
+	"github.com/FirinKinuo/capyback/cli/flag"
+	"github.com/FirinKinuo/capyback/config"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/pipe"
+	"github.com/FirinKinuo/capyback/storage"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// ErrorSourceMismatch is an error when files of the backup differ from the source tree.
+var ErrorSourceMismatch = errors.New("backup differs from the source")
+
+// Verify is a command for check that a backup in storage can be restored.
+type Verify struct {
+	command   *cobra.Command
+	appConfig *config.Config
+
+	backupName string
+	source     string
+
+	storageFlagSet    *flag.StorageFlagSet
+	configFlagSet     *flag.ConfigFlagSet
+	encryptionFlagSet *flag.EncryptionFlagSet
+	repositoryFlagSet *flag.RepositoryFlagSet
+
+	storager  storage.Storager
+	archiver  archive.Archiver
+	decrypter crypt.Decrypter
+}
+
+// NewVerify creates a new Verify.
+func NewVerify(defaultConfigPath string) *Verify {
+	verify := &Verify{
+		storageFlagSet:    flag.NewStorageFlagSet(),
+		configFlagSet:     flag.NewConfigFlagSet(defaultConfigPath),
+		encryptionFlagSet: flag.NewEncryptionFlagSet(),
+		repositoryFlagSet: flag.NewRepositoryFlagSet(),
+	}
+
+	command := &cobra.Command{
+		Use:   "verify BACKUP",
+		Short: "Verify backup in storage can be restored",
+		Args:  cobra.ExactArgs(1),
+		RunE:  verify.run,
+	}
+
+	command.PersistentFlags().AddFlagSet(verify.FlagSet())
+
+	verify.command = command
+
+	return verify
+}
+
+// FlagSet returns a flag set for verify command.
+func (v *Verify) FlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("verify", pflag.PanicOnError)
+
+	flagSet.StringVarP(
+		&v.source,
+		"source",
+		"s",
+		"",
+		"compare files of the backup with the source directory, as if the backup was restored into it",
+	)
+
+	flagSet.AddFlagSet(v.storageFlagSet.FlagSet())
+	flagSet.AddFlagSet(v.configFlagSet.FlagSet())
+	flagSet.AddFlagSet(v.repositoryFlagSet.FlagSet())
+	flagSet.AddFlagSet(v.encryptionFlagSet.DecryptFlagSet())
+
+	return flagSet
+}
+
+func (v *Verify) Command() *cobra.Command {
+	return v.command
+}
+
+// configure configures the verify command from flag sets.
+func (v *Verify) configure(args []string) error {
+	v.backupName = args[0]
+
+	var err error
+	v.appConfig, err = readConfig(v.configFlagSet, v.storageFlagSet, v.repositoryFlagSet)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	// Encrypted backup name ends with an encryption suffix after the archive format
+	v.archiver, err = archive.IdentifyArchiver(crypt.TrimSuffix(v.backupName))
+	if err != nil {
+		return fmt.Errorf("identify archiver: %w", err)
+	}
+
+	v.encryptionFlagSet.Apply(&v.appConfig.Encryption)
+
+	if crypt.IsEncrypted(v.backupName) {
+		v.decrypter, err = v.appConfig.Encryption.ReadDecrypter()
+		if err != nil {
+			return fmt.Errorf("read decrypter: %w", err)
+		}
+	} else {
+		// Objects of the repository may be encrypted, even if the backup name is not
+		v.decrypter, err = readOptionalDecrypter(&v.appConfig.Encryption)
+		if err != nil {
+			return err
+		}
+	}
+
+	v.storager, err = readStorage(v.appConfig, &v.appConfig.Storage, nil, v.decrypter)
+	if err != nil {
+		return fmt.Errorf("read storager: %w", err)
+	}
+
+	return nil
+}
+
+// performVerify reads the backup and reports whether it is intact and matches the source.
+func (v *Verify) performVerify(ctx context.Context) error {
+	err := v.storager.Authenticate(ctx)
+	if err != nil {
+		return fmt.Errorf("authenticate storage: %w", err)
+	}
+
+	inMemoryPipe, err := pipe.NewPipe(pipe.InMemoryPipeType)
+	if err != nil {
+		return fmt.Errorf("create new pipe: %w", err)
+	}
+	defer func() {
+		inMemoryPipe.CloseWrite()
+		inMemoryPipe.CloseRead()
+	}()
+
+	verify := application.NewVerify(inMemoryPipe, v.storager, v.archiver)
+	if crypt.IsEncrypted(v.backupName) {
+		verify.SetDecrypter(v.decrypter)
+	}
+	if v.source != "" {
+		verify.SetSource(v.source)
+	}
+
+	objectParams, err := v.appConfig.Storage.ReadObjectParams()
+	if err != nil {
+		return fmt.Errorf("read object params: %w", err)
+	}
+	objectParams.SetName(v.backupName)
+
+	log.Infof("Verify backup: %s", v.backupName)
+
+	report, err := verify.Verify(ctx, objectParams)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+
+	log.Info(
+		"Backup verified",
+		"entries", report.Entries,
+		"size", bytesize.Size(report.Bytes),
+		"sha256", report.Checksum,
+		"checksum-matched", report.Checked,
+	)
+
+	if len(report.Mismatches) > 0 {
+		return fmt.Errorf("%w: %d mismatches", ErrorSourceMismatch, len(report.Mismatches))
+	}
+
+	return nil
+}
+
+func (v *Verify) run(_ *cobra.Command, args []string) error {
+	err := v.configure(args)
+	if err != nil {
+		return configError(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = v.performVerify(ctx)
+	if err != nil {
+		return performError(ctx, "perform verify", err)
+	}
+
+	return nil
+}
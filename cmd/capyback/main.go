@@ -1,8 +1,12 @@
 package main
 
 import (
+	"os"
+
 	"github.com/FirinKinuo/capyback/cli"
 	"github.com/FirinKinuo/configpath"
+
+	"github.com/charmbracelet/log"
 )
 
 var (
@@ -18,5 +22,13 @@ func main() {
 	userConfigPath := configPath.UserFile(defaultConfigFile)
 
 	capybackCli := cli.NewCapyback(version, userConfigPath)
-	_ = capybackCli.Execute()
+	err := capybackCli.Execute()
+
+	exitCode := cli.ExitCode(err)
+	// Cancellation is logged by the command, it is not an error to report
+	if err != nil && exitCode != cli.ExitCancelled {
+		log.Error(err)
+	}
+
+	os.Exit(exitCode)
 }
@@ -2,6 +2,12 @@ package config
 
 import (
 	"fmt"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/filter"
+	"github.com/FirinKinuo/capyback/hook"
+	"github.com/FirinKinuo/capyback/pipe"
+	"github.com/FirinKinuo/capyback/repository"
+	"github.com/FirinKinuo/capyback/retention"
 	"github.com/FirinKinuo/capyback/storage"
 	"gopkg.in/yaml.v3"
 	"os"
@@ -9,7 +15,14 @@ import (
 )
 
 type Config struct {
-	Storage storage.Config `yaml:"storage"`
+	Storage    storage.Config    `yaml:"storage"`
+	Retention  retention.Config  `yaml:"retention"`
+	Encryption crypt.Config      `yaml:"encryption"`
+	Filter     filter.Config     `yaml:"filter"`
+	Pipe       pipe.Config       `yaml:"pipe"`
+	Repository repository.Config `yaml:"repository"`
+	Hooks      hook.Config       `yaml:"hooks"`
+	Jobs       map[string]Job    `yaml:"jobs"`
 }
 
 func NewConfig() *Config {
@@ -40,6 +53,16 @@ func (c *Config) ReadYaml(path string) error {
 	return nil
 }
 
+// ReadFromEnviron overrides configuration with environment variables
+func (c *Config) ReadFromEnviron() error {
+	err := c.Storage.ReadFromEnviron()
+	if err != nil {
+		return fmt.Errorf("read storage environ: %w", err)
+	}
+
+	return nil
+}
+
 func (c *Config) makeConfigFolder(path string) error {
 	err := os.MkdirAll(path, 0774)
 	if err != nil {
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/FirinKinuo/capyback/filter"
+	"github.com/FirinKinuo/capyback/hook"
+	"github.com/FirinKinuo/capyback/storage"
+)
+
+// ErrorUnknownJob is an error when a job is not found in the config.
+var ErrorUnknownJob = errors.New("unknown job")
+
+// Job is a named backup described in the config, so it can be run without repeating its settings.
+type Job struct {
+	Resources []string `yaml:"resources"`
+	// Command is a shell command, whose output is backed up instead of resources, like a database dump.
+	Command string `yaml:"command"`
+	// StreamName is the file name of the command output in an archive, the backup name is used when it is empty.
+	StreamName string `yaml:"stream-name"`
+	// Name is a backup name template without format, see naming.Expand.
+	// The name of the only resource is used when it is empty.
+	Name string `yaml:"name"`
+	// Format is an archive format, the default format is used when it is empty.
+	Format string `yaml:"format"`
+	// Filter extends the filter of the config.
+	Filter filter.Config `yaml:"filter"`
+	// Storage replaces the storage of the config.
+	Storage *storage.Config `yaml:"storage"`
+	// Incremental archives only files changed since the previous backup of the job.
+	Incremental bool `yaml:"incremental"`
+	// Hooks extend hooks of the config, hooks of the config are run first.
+	Hooks hook.Config `yaml:"hooks"`
+}
+
+// Job returns the job by name.
+func (c *Config) Job(name string) (Job, error) {
+	job, ok := c.Jobs[name]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrorUnknownJob, name)
+	}
+
+	return job, nil
+}
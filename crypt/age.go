@@ -0,0 +1,224 @@
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Suffix is appended to names of encrypted backups.
+const Suffix = ".age"
+
+// Format is the name of encryption format stored in backup metadata.
+const Format = "age"
+
+const envPassphrase = "CAPYBACK_PASSPHRASE"
+
+var (
+	// ErrorNoRecipients is an error when encryption is requested without any recipient or passphrase.
+	ErrorNoRecipients = errors.New("encryption requires recipients or a passphrase")
+	// ErrorNoIdentities is an error when an encrypted backup is read without any identity or passphrase.
+	ErrorNoIdentities = errors.New("backup is encrypted, an identity or a passphrase is required")
+	// ErrorPassphraseWithRecipients is an error when a passphrase is combined with recipients.
+	ErrorPassphraseWithRecipients = errors.New("passphrase can not be combined with recipients")
+)
+
+// Config describes keys of age encryption.
+// Backups are encrypted to Recipients (age1... public keys) or to a passphrase,
+// which is read from PassphraseFile or from CAPYBACK_PASSPHRASE environment variable.
+// Encrypted backups are decrypted with identities from IdentityFile or with the passphrase.
+type Config struct {
+	// Enabled forces encryption, which is otherwise enabled by recipients or a passphrase file.
+	Enabled        bool     `yaml:"enabled"`
+	Recipients     []string `yaml:"recipients"`
+	RecipientsFile string   `yaml:"recipients-file"`
+	IdentityFile   string   `yaml:"identity-file"`
+	PassphraseFile string   `yaml:"passphrase-file"`
+}
+
+// EncryptionEnabled reports whether new backups should be encrypted.
+func (c *Config) EncryptionEnabled() bool {
+	return c.Enabled || len(c.Recipients) > 0 || c.RecipientsFile != "" || c.PassphraseFile != ""
+}
+
+// IsEncrypted reports whether the backup name has the encrypted backup suffix.
+func IsEncrypted(name string) bool {
+	return strings.HasSuffix(name, Suffix)
+}
+
+// TrimSuffix returns the backup name without the encrypted backup suffix.
+func TrimSuffix(name string) string {
+	return strings.TrimSuffix(name, Suffix)
+}
+
+// readPassphrase reads the passphrase from the file, or from the environment in passphrase mode,
+// when no keys are configured, so an exported CAPYBACK_PASSPHRASE does not interfere with keys.
+func (c *Config) readPassphrase(withKeys bool) (string, error) {
+	if c.PassphraseFile == "" {
+		if withKeys {
+			return "", nil
+		}
+
+		return os.Getenv(envPassphrase), nil
+	}
+
+	passphrase, err := os.ReadFile(c.PassphraseFile)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase file: %w", err)
+	}
+
+	return strings.TrimRight(string(passphrase), "\r\n"), nil
+}
+
+func (c *Config) readRecipients() ([]age.Recipient, error) {
+	recipientLines := strings.Join(c.Recipients, "\n")
+
+	if c.RecipientsFile != "" {
+		recipientsFile, err := os.ReadFile(c.RecipientsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read recipients file: %w", err)
+		}
+
+		recipientLines += "\n" + string(recipientsFile)
+	}
+
+	if strings.TrimSpace(recipientLines) == "" {
+		return nil, nil
+	}
+
+	recipients, err := age.ParseRecipients(strings.NewReader(recipientLines))
+	if err != nil {
+		return nil, fmt.Errorf("parse recipients: %w", err)
+	}
+
+	return recipients, nil
+}
+
+func (c *Config) readIdentities() ([]age.Identity, error) {
+	if c.IdentityFile == "" {
+		return nil, nil
+	}
+
+	identityFile, err := os.Open(c.IdentityFile)
+	if err != nil {
+		return nil, fmt.Errorf("open identity file: %w", err)
+	}
+	defer identityFile.Close()
+
+	identities, err := age.ParseIdentities(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("parse identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+// ReadEncrypter returns an Encrypter to configured recipients or passphrase.
+func (c *Config) ReadEncrypter() (Encrypter, error) {
+	recipients, err := c.readRecipients()
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := c.readPassphrase(len(recipients) > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if passphrase != "" {
+		// age does not allow a passphrase recipient next to any other recipient
+		if len(recipients) > 0 {
+			return nil, ErrorPassphraseWithRecipients
+		}
+
+		scryptRecipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("create passphrase recipient: %w", err)
+		}
+
+		recipients = append(recipients, scryptRecipient)
+	}
+
+	if len(recipients) == 0 {
+		return nil, ErrorNoRecipients
+	}
+
+	return &AgeCipher{recipients: recipients}, nil
+}
+
+// ReadDecrypter returns a Decrypter with configured identities or passphrase.
+func (c *Config) ReadDecrypter() (Decrypter, error) {
+	identities, err := c.readIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := c.readPassphrase(len(identities) > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if passphrase != "" {
+		scryptIdentity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("create passphrase identity: %w", err)
+		}
+
+		identities = append(identities, scryptIdentity)
+	}
+
+	if len(identities) == 0 {
+		return nil, ErrorNoIdentities
+	}
+
+	return &AgeCipher{identities: identities}, nil
+}
+
+// AgeCipher encrypts and decrypts streams with age format.
+type AgeCipher struct {
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+func (a *AgeCipher) Encrypt(out io.Writer) (io.WriteCloser, error) {
+	return age.Encrypt(out, a.recipients...)
+}
+
+func (a *AgeCipher) Decrypt(in io.Reader) (io.Reader, error) {
+	return age.Decrypt(in, a.identities...)
+}
+
+// GenerateKey generates a new age X25519 key and returns its identity and recipient.
+// Unlike a passphrase, the key encrypts and decrypts many small objects fast.
+func GenerateKey() (identity string, recipient string, err error) {
+	x25519Identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", "", fmt.Errorf("generate key: %w", err)
+	}
+
+	return x25519Identity.String(), x25519Identity.Recipient().String(), nil
+}
+
+// NewRecipientEncrypter returns an Encrypter to the age X25519 recipient.
+func NewRecipientEncrypter(recipient string) (Encrypter, error) {
+	x25519Recipient, err := age.ParseX25519Recipient(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("parse recipient: %w", err)
+	}
+
+	return &AgeCipher{recipients: []age.Recipient{x25519Recipient}}, nil
+}
+
+// NewIdentityDecrypter returns a Decrypter with the age X25519 identity.
+func NewIdentityDecrypter(identity string) (Decrypter, error) {
+	x25519Identity, err := age.ParseX25519Identity(identity)
+	if err != nil {
+		return nil, fmt.Errorf("parse identity: %w", err)
+	}
+
+	return &AgeCipher{identities: []age.Identity{x25519Identity}}, nil
+}
@@ -0,0 +1,14 @@
+package crypt
+
+import "io"
+
+// Encrypter wraps a writer so everything written to it is encrypted.
+type Encrypter interface {
+	// Encrypt returns a writer which must be closed to flush the last encrypted chunk.
+	Encrypt(out io.Writer) (io.WriteCloser, error)
+}
+
+// Decrypter wraps a reader of encrypted stream.
+type Decrypter interface {
+	Decrypt(in io.Reader) (io.Reader, error)
+}
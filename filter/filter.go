@@ -0,0 +1,194 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Config describes which files are excluded from backups.
+// Include patterns take precedence over exclude patterns and ignore files,
+// but can not re-include a file from an excluded directory, since excluded directories are not walked.
+type Config struct {
+	Exclude []string `yaml:"exclude"`
+	Include []string `yaml:"include"`
+	// ExcludeFrom lists files with exclude patterns, one per line.
+	ExcludeFrom []string `yaml:"exclude-from"`
+	// IgnoreFiles lists names of ignore files, like .gitignore, honored in every walked directory.
+	IgnoreFiles []string `yaml:"ignore-files"`
+}
+
+// Extend returns a config with patterns and ignore files of both configs.
+func (c *Config) Extend(other Config) Config {
+	return Config{
+		Exclude:     append(append([]string{}, c.Exclude...), other.Exclude...),
+		Include:     append(append([]string{}, c.Include...), other.Include...),
+		ExcludeFrom: append(append([]string{}, c.ExcludeFrom...), other.ExcludeFrom...),
+		IgnoreFiles: append(append([]string{}, c.IgnoreFiles...), other.IgnoreFiles...),
+	}
+}
+
+// ReadFilter parses patterns of the config and files with patterns.
+func (c *Config) ReadFilter() (*Filter, error) {
+	exclude, err := parsePatterns(c.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("parse exclude: %w", err)
+	}
+
+	for _, excludeFrom := range c.ExcludeFrom {
+		patterns, err := readPatternsFile(excludeFrom)
+		if err != nil {
+			return nil, fmt.Errorf("read exclude from %s: %w", excludeFrom, err)
+		}
+
+		exclude = append(exclude, patterns...)
+	}
+
+	include, err := parsePatterns(c.Include)
+	if err != nil {
+		return nil, fmt.Errorf("parse include: %w", err)
+	}
+
+	return &Filter{
+		exclude:     exclude,
+		include:     include,
+		ignoreFiles: c.IgnoreFiles,
+	}, nil
+}
+
+func parsePatterns(lines []string) ([]*Pattern, error) {
+	patterns := make([]*Pattern, 0, len(lines))
+
+	for _, line := range lines {
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if pattern != nil {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns, nil
+}
+
+func readPatternsFile(name string) ([]*Pattern, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePatterns(lines)
+}
+
+// Filter decides which files are excluded from backups.
+type Filter struct {
+	exclude     []*Pattern
+	include     []*Pattern
+	ignoreFiles []string
+}
+
+// NewWalker returns a Walker of the tree rooted at root.
+func (f *Filter) NewWalker(root string) *Walker {
+	return &Walker{
+		filter: f,
+		root:   root,
+		scopes: make(map[string][]*Pattern),
+	}
+}
+
+// Walker tracks patterns from ignore files of a walked tree.
+// Directories must be entered before their contents are matched, as filepath.WalkDir does.
+type Walker struct {
+	filter *Filter
+	root   string
+	// scopes maps slash separated directories relative to the root to patterns of their ignore files.
+	scopes map[string][]*Pattern
+}
+
+// EnterDir reads ignore files of the directory relative to the root.
+func (w *Walker) EnterDir(relativeDir string) error {
+	var patterns []*Pattern
+
+	for _, ignoreFile := range w.filter.ignoreFiles {
+		filePatterns, err := readPatternsFile(filepath.Join(w.root, relativeDir, ignoreFile))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read ignore file: %w", err)
+		}
+
+		patterns = append(patterns, filePatterns...)
+	}
+
+	if len(patterns) > 0 {
+		w.scopes[filepath.ToSlash(relativeDir)] = patterns
+	}
+
+	return nil
+}
+
+// Excluded reports whether the path relative to the root is excluded.
+// Later patterns override earlier ones: exclude patterns go first, then ignore files from the root
+// to the closest directory, then include patterns.
+func (w *Walker) Excluded(relativePath string, isDir bool) bool {
+	relativePath = filepath.ToSlash(relativePath)
+	excluded := false
+
+	for _, pattern := range w.filter.exclude {
+		if pattern.Match(relativePath, isDir) {
+			excluded = !pattern.negate
+		}
+	}
+
+	for _, dir := range parentDirs(relativePath) {
+		pathInDir := relativePath
+		if dir != "." {
+			pathInDir = relativePath[len(dir)+1:]
+		}
+
+		for _, pattern := range w.scopes[dir] {
+			if pattern.Match(pathInDir, isDir) {
+				excluded = !pattern.negate
+			}
+		}
+	}
+
+	for _, pattern := range w.filter.include {
+		if pattern.Match(relativePath, isDir) {
+			excluded = pattern.negate
+		}
+	}
+
+	return excluded
+}
+
+// parentDirs returns parent directories of the slash separated path from the root ".".
+func parentDirs(relativePath string) []string {
+	var dirs []string
+
+	for dir := path.Dir(relativePath); dir != "."; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	return append([]string{"."}, dirs...)
+}
@@ -0,0 +1,89 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkerExcluded(t *testing.T) {
+	root := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(root, "web", "dist"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(root, "web", ".ignore"), []byte("dist/\n*.map\n!keep.map\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{
+		Exclude:     []string{"*.tmp", "cache/"},
+		Include:     []string{"important.tmp"},
+		IgnoreFiles: []string{".ignore"},
+	}
+
+	filter, err := config.ReadFilter()
+	if err != nil {
+		t.Fatalf("ReadFilter() error = %v", err)
+	}
+
+	walker := filter.NewWalker(root)
+	for _, dir := range []string{".", "web"} {
+		err = walker.EnterDir(dir)
+		if err != nil {
+			t.Fatalf("EnterDir(%q) error = %v", dir, err)
+		}
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: "notes.txt", want: false},
+		{path: "a/b.tmp", want: true},
+		{path: "important.tmp", want: false},
+		{path: "cache", isDir: true, want: true},
+		{path: "cache", isDir: false, want: false},
+		{path: "web/dist", isDir: true, want: true},
+		{path: "web/app.js.map", want: true},
+		{path: "web/keep.map", want: false},
+		// Ignore files apply only to their directory
+		{path: "app.js.map", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := walker.Excluded(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Excluded(%q, %t) = %t, want %t", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFilterExcludeFrom(t *testing.T) {
+	excludeFrom := filepath.Join(t.TempDir(), "exclude")
+
+	err := os.WriteFile(excludeFrom, []byte("# secrets\n*.key\n\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := (&Config{ExcludeFrom: []string{excludeFrom}}).ReadFilter()
+	if err != nil {
+		t.Fatalf("ReadFilter() error = %v", err)
+	}
+
+	walker := filter.NewWalker(t.TempDir())
+	if !walker.Excluded("ssh/id.key", false) {
+		t.Errorf("Excluded(%q) = false, want true", "ssh/id.key")
+	}
+
+	_, err = (&Config{ExcludeFrom: []string{excludeFrom + ".missing"}}).ReadFilter()
+	if err == nil {
+		t.Errorf("ReadFilter() of a missing exclude file error = nil, want an error")
+	}
+}
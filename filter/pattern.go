@@ -0,0 +1,133 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern is a gitignore-style pattern.
+//
+// A pattern without a slash matches a name at any depth, a pattern with a slash is relative to
+// the directory it is defined for. "*" and "?" do not match a slash, "**" matches any number of directories.
+// A trailing slash matches only directories and a leading "!" negates the pattern.
+type Pattern struct {
+	source  string
+	negate  bool
+	dirOnly bool
+	regexp  *regexp.Regexp
+}
+
+// ParsePattern parses a gitignore-style pattern.
+// It returns nil for blank lines and comments.
+func ParsePattern(line string) (*Pattern, error) {
+	pattern := &Pattern{source: line}
+
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	if line == "" {
+		return nil, fmt.Errorf("empty pattern %q", pattern.source)
+	}
+
+	expression := globToRegexp(line)
+	if !anchored {
+		expression = "(.*/)?" + expression
+	}
+
+	compiled, err := regexp.Compile("^" + expression + "$")
+	if err != nil {
+		return nil, fmt.Errorf("compile pattern %q: %w", pattern.source, err)
+	}
+
+	pattern.regexp = compiled
+
+	return pattern, nil
+}
+
+// Match reports whether the slash separated path relative to the pattern directory matches the pattern.
+func (p *Pattern) Match(path string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	return p.regexp.MatchString(path)
+}
+
+// String returns the pattern as it was written.
+func (p *Pattern) String() string {
+	return p.source
+}
+
+// globToRegexp converts a glob into a regular expression.
+func globToRegexp(glob string) string {
+	var expression strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		char := glob[i]
+
+		switch char {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' && (i == 0 || glob[i-1] == '/') {
+				switch {
+				case i+2 == len(glob):
+					expression.WriteString(".*")
+					i++
+					continue
+				case glob[i+2] == '/':
+					expression.WriteString("(.*/)?")
+					i += 2
+					continue
+				}
+			}
+
+			expression.WriteString("[^/]*")
+
+		case '?':
+			expression.WriteString("[^/]")
+
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expression.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			expression.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			expression.WriteString(regexp.QuoteMeta(string(glob[i])))
+
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	return expression.String()
+}
@@ -0,0 +1,68 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestParsePatternSkipsBlankAndComments(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment"} {
+		pattern, err := ParsePattern(line)
+		if err != nil || pattern != nil {
+			t.Errorf("ParsePattern(%q) = %v, %v, want nil", line, pattern, err)
+		}
+	}
+
+	_, err := ParsePattern("/")
+	if err == nil {
+		t.Errorf("ParsePattern(%q) error = nil, want an error of an empty pattern", "/")
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{pattern: "*.log", path: "app.log", want: true},
+		{pattern: "*.log", path: "var/log/app.log", want: true},
+		{pattern: "*.log", path: "app.log.1", want: false},
+		{pattern: "node_modules/", path: "web/node_modules", isDir: true, want: true},
+		{pattern: "node_modules/", path: "web/node_modules", isDir: false, want: false},
+		{pattern: "/build", path: "build", isDir: true, want: true},
+		{pattern: "/build", path: "src/build", isDir: true, want: false},
+		{pattern: "src/*.go", path: "src/main.go", want: true},
+		{pattern: "src/*.go", path: "src/cmd/main.go", want: false},
+		{pattern: "src/**/*.go", path: "src/main.go", want: true},
+		{pattern: "src/**/*.go", path: "src/cmd/app/main.go", want: true},
+		{pattern: "**/cache", path: "a/b/cache", isDir: true, want: true},
+		{pattern: "**/cache", path: "cache", isDir: true, want: true},
+		{pattern: "tmp/**", path: "tmp/a/b", want: true},
+		{pattern: "tmp/**", path: "tmp", isDir: true, want: false},
+		{pattern: "file?.txt", path: "file1.txt", want: true},
+		{pattern: "file?.txt", path: "file10.txt", want: false},
+		{pattern: "[abc].txt", path: "b.txt", want: true},
+		{pattern: "[!abc].txt", path: "b.txt", want: false},
+		{pattern: "[!abc].txt", path: "d.txt", want: true},
+		{pattern: `\#notes`, path: "#notes", want: true},
+		{pattern: `\!important`, path: "!important", want: true},
+		{pattern: `star\*`, path: "star*", want: true},
+		{pattern: `star\*`, path: "stars", want: false},
+		{pattern: "a+b.(txt)", path: "a+b.(txt)", want: true},
+		{pattern: "!*.log", path: "app.log", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			pattern, err := ParsePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("ParsePattern(%q) error = %v", tt.pattern, err)
+			}
+
+			if got := pattern.Match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("%q.Match(%q, %t) = %t, want %t", tt.pattern, tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
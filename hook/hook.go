@@ -0,0 +1,240 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FirinKinuo/capyback/shell"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Stage is a moment of the backup when hooks are run.
+type Stage string
+
+const (
+	// Before hooks are run before archiving, a failed hook with abort policy cancels the backup.
+	Before Stage = "before"
+	// After hooks are run after the backup, whether it succeeded or not.
+	After Stage = "after"
+	// OnSuccess hooks are run after a successful backup.
+	OnSuccess Stage = "on-success"
+	// OnFailure hooks are run after a failed backup.
+	OnFailure Stage = "on-failure"
+)
+
+// Policy decides what a failed hook means for the backup.
+type Policy string
+
+const (
+	// AbortPolicy fails the backup, when the hook fails. Before hooks after the failed one are not run.
+	AbortPolicy Policy = "abort"
+	// WarnPolicy only logs the failure of the hook.
+	WarnPolicy Policy = "warn"
+)
+
+// Environment variables, which describe the backup to hooks.
+const (
+	EnvStage      = "CAPYBACK_HOOK"
+	EnvJob        = "CAPYBACK_JOB"
+	EnvResources  = "CAPYBACK_RESOURCES"
+	EnvBackupName = "CAPYBACK_BACKUP_NAME"
+	EnvStatus     = "CAPYBACK_STATUS"
+	EnvObjectSize = "CAPYBACK_OBJECT_SIZE"
+	EnvSha256     = "CAPYBACK_SHA256"
+	EnvError      = "CAPYBACK_ERROR"
+)
+
+// waitDelay is how long a killed hook is waited for, before its output is closed.
+const waitDelay = 5 * time.Second
+
+// Statuses of the backup in EnvStatus.
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+var (
+	// ErrorUnknownPolicy is an error when the failure policy of a hook is not supported.
+	ErrorUnknownPolicy = errors.New("unknown hook policy, available: abort, warn")
+	// ErrorEmptyCommand is an error when a hook has no command.
+	ErrorEmptyCommand = errors.New("hook command is empty")
+)
+
+// UnmarshalText sets the Policy from its text representation.
+func (p *Policy) UnmarshalText(text []byte) error {
+	switch Policy(text) {
+	case AbortPolicy, WarnPolicy, "":
+		*p = Policy(text)
+	default:
+		return fmt.Errorf("%w: %q", ErrorUnknownPolicy, text)
+	}
+
+	return nil
+}
+
+// Hook is a shell command run at a stage of the backup.
+// The backup is described by CAPYBACK_* environment variables, output of the command goes to stderr.
+type Hook struct {
+	Command string `yaml:"command"`
+	// Timeout kills the command, when it runs longer, zero means no timeout.
+	Timeout time.Duration `yaml:"timeout"`
+	// OnError is the failure policy, abort is used when it is empty.
+	OnError Policy `yaml:"on-error"`
+}
+
+// UnmarshalYAML reads a hook from a mapping, or from a string, which is the command.
+func (h *Hook) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&h.Command)
+	}
+
+	type plainHook Hook
+
+	return node.Decode((*plainHook)(h))
+}
+
+func (h *Hook) policy() Policy {
+	if h.OnError == "" {
+		return AbortPolicy
+	}
+
+	return h.OnError
+}
+
+// Config describes hooks of backups.
+type Config struct {
+	Before    []Hook `yaml:"before"`
+	After     []Hook `yaml:"after"`
+	OnSuccess []Hook `yaml:"on-success"`
+	OnFailure []Hook `yaml:"on-failure"`
+}
+
+// Extend returns a config with hooks of both configs, hooks of the config are run first.
+func (c *Config) Extend(other Config) Config {
+	return Config{
+		Before:    append(append([]Hook{}, c.Before...), other.Before...),
+		After:     append(append([]Hook{}, c.After...), other.After...),
+		OnSuccess: append(append([]Hook{}, c.OnSuccess...), other.OnSuccess...),
+		OnFailure: append(append([]Hook{}, c.OnFailure...), other.OnFailure...),
+	}
+}
+
+// Empty reports whether the config has no hooks.
+func (c *Config) Empty() bool {
+	return len(c.Before) == 0 && len(c.After) == 0 && len(c.OnSuccess) == 0 && len(c.OnFailure) == 0
+}
+
+func (c *Config) hooks(stage Stage) []Hook {
+	switch stage {
+	case Before:
+		return c.Before
+	case After:
+		return c.After
+	case OnSuccess:
+		return c.OnSuccess
+	case OnFailure:
+		return c.OnFailure
+	default:
+		return nil
+	}
+}
+
+// Runner runs hooks of the config with environment describing the backup.
+type Runner struct {
+	config Config
+	env    map[string]string
+}
+
+// NewRunner creates a Runner of hooks of the config.
+func NewRunner(config Config) *Runner {
+	return &Runner{config: config, env: make(map[string]string)}
+}
+
+// SetEnv sets the environment variable for all hooks of the runner.
+func (r *Runner) SetEnv(key string, value string) {
+	r.env[key] = value
+}
+
+// Run runs hooks of the stage one by one with the environment of the runner extended with env.
+// Failed hooks with abort policy are returned as an error, a failed before hook stops the rest of before hooks.
+func (r *Runner) Run(ctx context.Context, stage Stage, env map[string]string) error {
+	var hookErrors []error
+
+	for _, hook := range r.config.hooks(stage) {
+		err := r.run(ctx, stage, &hook, env)
+		if err == nil {
+			continue
+		}
+
+		err = fmt.Errorf("%s hook %q: %w", stage, hook.Command, err)
+
+		if hook.policy() == WarnPolicy {
+			log.Warn("Hook failed", "err", err)
+			continue
+		}
+
+		if stage == Before {
+			return err
+		}
+
+		hookErrors = append(hookErrors, err)
+	}
+
+	return errors.Join(hookErrors...)
+}
+
+func (r *Runner) run(ctx context.Context, stage Stage, hook *Hook, env map[string]string) error {
+	if strings.TrimSpace(hook.Command) == "" {
+		return ErrorEmptyCommand
+	}
+
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+
+	log.Info("Run hook", "stage", stage, "command", hook.Command)
+
+	command := shell.Command(ctx, hook.Command)
+	command.Stdout = os.Stderr
+	command.Stderr = os.Stderr
+	command.Env = append(os.Environ(), r.environ(stage, env)...)
+	command.WaitDelay = waitDelay
+	setProcessGroup(command)
+
+	err := command.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", hook.Timeout)
+	}
+
+	return err
+}
+
+// environ returns environment variables of the hook as KEY=value, sorted for reproducible runs.
+func (r *Runner) environ(stage Stage, env map[string]string) []string {
+	variables := map[string]string{EnvStage: string(stage)}
+
+	for key, value := range r.env {
+		variables[key] = value
+	}
+
+	for key, value := range env {
+		variables[key] = value
+	}
+
+	environ := make([]string, 0, len(variables))
+	for key, value := range variables {
+		environ = append(environ, key+"="+value)
+	}
+	sort.Strings(environ)
+
+	return environ
+}
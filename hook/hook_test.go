@@ -0,0 +1,138 @@
+//go:build unix
+
+package hook
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunnerRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		stage        Stage
+		hooks        []Hook
+		env          map[string]string
+		wantErr      string
+		wantFiles    map[string]string
+		missingFiles []string
+	}{
+		{
+			name:      "success",
+			stage:     Before,
+			hooks:     []Hook{{Command: `echo ok > "$TEST_DIR/first"`}},
+			wantFiles: map[string]string{"first": "ok\n"},
+		},
+		{
+			name:  "abort before",
+			stage: Before,
+			hooks: []Hook{
+				{Command: "exit 3"},
+				{Command: `touch "$TEST_DIR/second"`},
+			},
+			wantErr:      `before hook "exit 3": exit status 3`,
+			missingFiles: []string{"second"},
+		},
+		{
+			name:  "abort after",
+			stage: After,
+			hooks: []Hook{
+				{Command: "exit 3", OnError: AbortPolicy},
+				{Command: `touch "$TEST_DIR/second"`},
+			},
+			wantErr:   `after hook "exit 3": exit status 3`,
+			wantFiles: map[string]string{"second": ""},
+		},
+		{
+			name:  "warn",
+			stage: Before,
+			hooks: []Hook{
+				{Command: "exit 3", OnError: WarnPolicy},
+				{Command: `touch "$TEST_DIR/second"`},
+			},
+			wantFiles: map[string]string{"second": ""},
+		},
+		{
+			name:    "empty command",
+			stage:   OnFailure,
+			hooks:   []Hook{{Command: " "}},
+			wantErr: ErrorEmptyCommand.Error(),
+		},
+		{
+			name:  "timeout kills children",
+			stage: Before,
+			hooks: []Hook{
+				{Command: `(sleep 0.5; touch "$TEST_DIR/late") & wait`, Timeout: 100 * time.Millisecond},
+			},
+			wantErr:      "timed out after 100ms",
+			missingFiles: []string{"late"},
+		},
+		{
+			name:  "environment",
+			stage: OnSuccess,
+			hooks: []Hook{
+				{Command: `printf '%s %s %s' "$CAPYBACK_HOOK" "$CAPYBACK_JOB" "$CAPYBACK_STATUS" > "$TEST_DIR/env"`},
+			},
+			env:       map[string]string{EnvStatus: StatusSuccess},
+			wantFiles: map[string]string{"env": "on-success db success"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := t.TempDir()
+
+			config := Config{}
+			switch tt.stage {
+			case Before:
+				config.Before = tt.hooks
+			case After:
+				config.After = tt.hooks
+			case OnSuccess:
+				config.OnSuccess = tt.hooks
+			case OnFailure:
+				config.OnFailure = tt.hooks
+			}
+
+			runner := NewRunner(config)
+			runner.SetEnv("TEST_DIR", directory)
+			runner.SetEnv(EnvJob, "db")
+
+			err := runner.Run(context.Background(), tt.stage, tt.env)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("run: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+
+			// Children of a killed hook would create their files after the timeout
+			if len(tt.missingFiles) > 0 {
+				time.Sleep(time.Second)
+			}
+
+			for name, want := range tt.wantFiles {
+				content, err := os.ReadFile(filepath.Join(directory, name))
+				if err != nil {
+					t.Fatalf("hook output: %v", err)
+				}
+
+				if string(content) != want {
+					t.Errorf("%s = %q, want %q", name, content, want)
+				}
+			}
+
+			for _, name := range tt.missingFiles {
+				_, err := os.Stat(filepath.Join(directory, name))
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("%s exists, error %v, want not exist", name, err)
+				}
+			}
+		})
+	}
+}
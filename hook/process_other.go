@@ -0,0 +1,8 @@
+//go:build !unix
+
+package hook
+
+import "os/exec"
+
+// setProcessGroup does nothing, process groups are not available on this platform, only the shell is killed.
+func setProcessGroup(_ *exec.Cmd) {}
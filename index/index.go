@@ -0,0 +1,217 @@
+package index
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix is appended to the backup name without encryption suffix to get the name of its index.
+const Suffix = ".index.json.gz"
+
+// ErrorUnsafePath is an error when a deleted path of the index points outside the restore target.
+var ErrorUnsafePath = errors.New("deleted path points outside the target directory")
+
+// Entry describes a file of the backup, Path is the name of the file in archive.
+type Entry struct {
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mod-time"`
+	Mode    fs.FileMode `json:"mode"`
+	Inode   uint64      `json:"inode,omitempty"`
+	// Hash is a hex sha256 of content of a regular file.
+	Hash string `json:"hash,omitempty"`
+}
+
+// unchanged reports whether the file is the same as the entry of the previous backup.
+func (e *Entry) unchanged(previous *Entry) bool {
+	return e.Size == previous.Size &&
+		e.ModTime.Equal(previous.ModTime) &&
+		e.Mode == previous.Mode &&
+		e.Inode == previous.Inode
+}
+
+// Index lists files of a backup, so the next backup of the same series archives only changed files.
+// A full backup has no Parent, an incremental backup contains files changed since the Parent backup
+// and lists files Deleted since it.
+type Index struct {
+	// Series identifies backups of the same resources, only indexes of the same series are chained.
+	Series  string    `json:"series"`
+	Backup  string    `json:"backup"`
+	Parent  string    `json:"parent,omitempty"`
+	Created time.Time `json:"created"`
+	Entries []Entry   `json:"entries"`
+	Deleted []string  `json:"deleted,omitempty"`
+}
+
+// Name returns the name of the index of the backup.
+func Name(backupName string) string {
+	return backupName + Suffix
+}
+
+// IsIndex reports whether the object name is a name of an index, possibly encrypted.
+func IsIndex(name string) bool {
+	return strings.HasSuffix(name, Suffix) || strings.Contains(name, Suffix+".")
+}
+
+// Incremental reports whether the backup contains only changes since the parent backup.
+func (i *Index) Incremental() bool {
+	return i.Parent != ""
+}
+
+// Write writes the index as gzipped json.
+func (i *Index) Write(out io.Writer) error {
+	gzipWriter := gzip.NewWriter(out)
+
+	err := json.NewEncoder(gzipWriter).Encode(i)
+	if err != nil {
+		return fmt.Errorf("encode index: %w", err)
+	}
+
+	return gzipWriter.Close()
+}
+
+// Read reads the index written by Index.Write.
+func Read(in io.Reader) (*Index, error) {
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("open gzip: %w", err)
+	}
+	defer gzipReader.Close()
+
+	index := &Index{}
+
+	err = json.NewDecoder(gzipReader).Decode(index)
+	if err != nil {
+		return nil, fmt.Errorf("decode index: %w", err)
+	}
+
+	return index, nil
+}
+
+// ApplyDeletions removes files deleted since the parent backup from the restore target.
+func (i *Index) ApplyDeletions(target string) error {
+	for _, deleted := range i.Deleted {
+		if !filepath.IsLocal(filepath.FromSlash(deleted)) {
+			return fmt.Errorf("%s: %w", deleted, ErrorUnsafePath)
+		}
+
+		err := os.RemoveAll(filepath.Join(target, filepath.FromSlash(deleted)))
+		if err != nil {
+			return fmt.Errorf("remove %s: %w", deleted, err)
+		}
+	}
+
+	return nil
+}
+
+// Builder builds the index of a backup while the backup is archived.
+// Without a parent the backup is full and every file is archived.
+type Builder struct {
+	mu sync.Mutex
+
+	index   *Index
+	entries map[string]int
+	parent  map[string]*Entry
+}
+
+// NewBuilder creates a Builder of the index of the backup.
+func NewBuilder(series string, backupName string) *Builder {
+	return &Builder{
+		index: &Index{
+			Series: series,
+			Backup: backupName,
+		},
+		entries: make(map[string]int),
+	}
+}
+
+// SetParent makes the backup incremental to the backup of the parent index.
+func (b *Builder) SetParent(parent *Index) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.index.Parent = parent.Backup
+	b.parent = make(map[string]*Entry, len(parent.Entries))
+
+	for i := range parent.Entries {
+		b.parent[parent.Entries[i].Path] = &parent.Entries[i]
+	}
+}
+
+// Add adds the file to the index and reports whether it must be archived.
+// Directories are always archived, so empty directories are restored.
+// Unchanged files keep the hash of the parent backup.
+func (b *Builder) Add(nameInArchive string, info fs.FileInfo) bool {
+	entry := Entry{
+		Path:    nameInArchive,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Mode:    info.Mode(),
+		Inode:   inode(info),
+	}
+
+	if info.IsDir() {
+		entry.Size = 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	changed := true
+
+	if previous, ok := b.parent[nameInArchive]; ok && !info.IsDir() && entry.unchanged(previous) {
+		entry.Hash = previous.Hash
+		changed = false
+	}
+
+	b.entries[nameInArchive] = len(b.index.Entries)
+	b.index.Entries = append(b.index.Entries, entry)
+
+	return changed || info.IsDir()
+}
+
+// SetHash sets the hash of the archived file.
+func (b *Builder) SetHash(nameInArchive string, hash string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if i, ok := b.entries[nameInArchive]; ok {
+		b.index.Entries[i].Hash = hash
+	}
+}
+
+// Index returns the index with deletions since the parent backup, it is called after the backup is archived.
+func (b *Builder) Index() *Index {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.index.Created = time.Now()
+	b.index.Deleted = nil
+
+	for path := range b.parent {
+		if _, ok := b.entries[path]; !ok {
+			b.index.Deleted = append(b.index.Deleted, path)
+		}
+	}
+
+	sort.Strings(b.index.Deleted)
+	sort.Slice(b.index.Entries, func(i, j int) bool {
+		return b.index.Entries[i].Path < b.index.Entries[j].Path
+	})
+
+	for i, entry := range b.index.Entries {
+		b.entries[entry.Path] = i
+	}
+
+	return b.index
+}
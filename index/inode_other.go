@@ -0,0 +1,10 @@
+//go:build !unix
+
+package index
+
+import "io/fs"
+
+// inode returns zero, inode numbers are not available on this platform.
+func inode(_ fs.FileInfo) uint64 {
+	return 0
+}
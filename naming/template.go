@@ -0,0 +1,184 @@
+package naming
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// DefaultTimeLayout is a layout of {time} placeholder, which sorts lexically in chronological order.
+const DefaultTimeLayout = "20060102T150405Z0700"
+
+const idLength = 4
+
+var (
+	// ErrorUnknownPlaceholder is an error when the template contains a placeholder, which is not supported.
+	ErrorUnknownPlaceholder = errors.New("unknown placeholder")
+	// ErrorUnclosedPlaceholder is an error when the template contains "{" without closing "}".
+	ErrorUnclosedPlaceholder = errors.New("unclosed placeholder")
+	// ErrorUnknownDirective is an error when the template contains an unsupported strftime directive.
+	ErrorUnknownDirective = errors.New("unknown strftime directive")
+)
+
+// Variables are values of placeholders, which are evaluated once for the run.
+type Variables struct {
+	Time     time.Time
+	Hostname string
+	Job      string
+	User     string
+	ID       string
+}
+
+// NewVariables returns variables of the current run for the job.
+func NewVariables(job string) Variables {
+	variables := Variables{
+		Time: time.Now(),
+		Job:  job,
+		ID:   randomID(),
+	}
+
+	variables.Hostname, _ = os.Hostname()
+
+	if current, err := user.Current(); err == nil {
+		variables.User = current.Username
+	}
+
+	return variables
+}
+
+func randomID() string {
+	id := make([]byte, idLength)
+
+	_, err := rand.Read(id)
+	if err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// Expand evaluates placeholders of the template:
+//
+//	{time}          time in DefaultTimeLayout
+//	{time:LAYOUT}   time in Go layout, e.g. {time:2006-01-02}
+//	{utc:LAYOUT}    the same in UTC, LAYOUT is optional
+//	{hostname}      host name
+//	{job}           job name, empty for resources from arguments
+//	{user}          current user name
+//	{id}            short random hex id
+//	%Y, %m, %d ...  strftime directives of the time, %% is a literal percent
+//
+// Text outside placeholders is kept as is.
+func Expand(template string, variables Variables) (string, error) {
+	var result strings.Builder
+
+	for i := 0; i < len(template); i++ {
+		switch template[i] {
+		case '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("%w: %q", ErrorUnclosedPlaceholder, template[i:])
+			}
+
+			value, err := variables.placeholder(template[i+1 : i+end])
+			if err != nil {
+				return "", err
+			}
+
+			result.WriteString(value)
+			i += end
+
+		case '%':
+			if i+1 >= len(template) {
+				return "", fmt.Errorf("%w: %q", ErrorUnknownDirective, "%")
+			}
+
+			value, err := variables.directive(template[i+1])
+			if err != nil {
+				return "", err
+			}
+
+			result.WriteString(value)
+			i++
+
+		default:
+			result.WriteByte(template[i])
+		}
+	}
+
+	return result.String(), nil
+}
+
+func (v Variables) placeholder(name string) (string, error) {
+	name, layout, hasLayout := strings.Cut(name, ":")
+	if !hasLayout || layout == "" {
+		layout = DefaultTimeLayout
+	}
+
+	switch name {
+	case "time":
+		return v.Time.Format(layout), nil
+	case "utc":
+		return v.Time.UTC().Format(layout), nil
+	}
+
+	if hasLayout {
+		return "", fmt.Errorf("%w: {%s:%s}", ErrorUnknownPlaceholder, name, layout)
+	}
+
+	switch name {
+	case "hostname":
+		return v.Hostname, nil
+	case "job":
+		return v.Job, nil
+	case "user":
+		return v.User, nil
+	case "id":
+		return v.ID, nil
+	}
+
+	return "", fmt.Errorf("%w: {%s}", ErrorUnknownPlaceholder, name)
+}
+
+// directives maps strftime directives to Go time layouts.
+var directives = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'j': "002",
+	'z': "-0700",
+	'Z': "MST",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+}
+
+func (v Variables) directive(name byte) (string, error) {
+	switch name {
+	case '%':
+		return "%", nil
+	case 's':
+		return fmt.Sprint(v.Time.Unix()), nil
+	}
+
+	layout, ok := directives[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %%%c", ErrorUnknownDirective, name)
+	}
+
+	return v.Time.Format(layout), nil
+}
@@ -0,0 +1,76 @@
+package naming
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	variables := Variables{
+		Time:     time.Date(2024, time.March, 5, 14, 7, 9, 0, time.FixedZone("MSK", 3*60*60)),
+		Hostname: "db-1",
+		Job:      "postgres",
+		User:     "backup",
+		ID:       "a1b2c3d4",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  error
+	}{
+		{name: "plain text", template: "backup", want: "backup"},
+		{name: "default time", template: "{job}-{time}", want: "postgres-20240305T140709+0300"},
+		{name: "time layout", template: "{time:2006-01-02}", want: "2024-03-05"},
+		{name: "utc", template: "{utc}", want: "20240305T110709Z"},
+		{name: "utc layout", template: "{utc:15h}", want: "11h"},
+		{name: "variables", template: "{hostname}/{user}/{id}", want: "db-1/backup/a1b2c3d4"},
+		{name: "strftime date", template: "%Y/%m/%d", want: "2024/03/05"},
+		{name: "strftime time", template: "%H%M%S %I%p", want: "140709 02PM"},
+		{name: "strftime short forms", template: "%y %F %T %j", want: "24 2024-03-05 14:07:09 065"},
+		{name: "strftime names", template: "%a %A %b %B", want: "Tue Tuesday Mar March"},
+		{name: "strftime zone", template: "%z %Z", want: "+0300 MSK"},
+		{name: "strftime unix", template: "%s", want: "1709636829"},
+		{name: "literal percent", template: "100%%", want: "100%"},
+		{name: "mixed", template: "{job}-%Y%m%d-{id}", want: "postgres-20240305-a1b2c3d4"},
+		{name: "unknown placeholder", template: "{host}", wantErr: ErrorUnknownPlaceholder},
+		{name: "layout of not time placeholder", template: "{job:2006}", wantErr: ErrorUnknownPlaceholder},
+		{name: "unclosed placeholder", template: "{job", wantErr: ErrorUnclosedPlaceholder},
+		{name: "unknown directive", template: "%Q", wantErr: ErrorUnknownDirective},
+		{name: "trailing percent", template: "50%", wantErr: ErrorUnknownDirective},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.template, variables)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expand(%q) error = %v, want %v", tt.template, err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expand(%q) error = %v", tt.template, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Expand(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewVariables(t *testing.T) {
+	first, second := NewVariables("job"), NewVariables("job")
+
+	if len(first.ID) != 2*idLength {
+		t.Errorf("ID = %q, want %d hex digits", first.ID, 2*idLength)
+	}
+
+	if first.ID == second.ID {
+		t.Errorf("IDs of two runs are equal: %q", first.ID)
+	}
+}
@@ -0,0 +1,62 @@
+package pipe
+
+// Counter receives sizes of data going through a pipe
+type Counter interface {
+	// AddWritten counts data written to the pipe
+	AddWritten(n int64)
+	// AddRead counts data read from the pipe
+	AddRead(n int64)
+	// ResetRead starts counting of read data over, when the pipe is rewound
+	ResetRead()
+}
+
+// CountingPipe describes a pipe that passes sizes of written and read data to the counter
+type CountingPipe struct {
+	Piper
+	counter Counter
+}
+
+// Write writes to the pipe and counts written data
+func (cp *CountingPipe) Write(p []byte) (n int, err error) {
+	n, err = cp.Piper.Write(p)
+	cp.counter.AddWritten(int64(n))
+
+	return n, err
+}
+
+// Read reads from the pipe and counts read data
+func (cp *CountingPipe) Read(p []byte) (n int, err error) {
+	n, err = cp.Piper.Read(p)
+	cp.counter.AddRead(int64(n))
+
+	return n, err
+}
+
+// rewindableCountingPipe describes a counting pipe of a pipe that can be rewound
+type rewindableCountingPipe struct {
+	*CountingPipe
+}
+
+// Rewind rewinds the pipe and starts counting of read data over
+func (rp *rewindableCountingPipe) Rewind() error {
+	err := rp.Piper.(Rewinder).Rewind()
+	if err != nil {
+		return err
+	}
+
+	rp.counter.ResetRead()
+
+	return nil
+}
+
+// NewCountingPipe wraps the pipe into a pipe that counts data with the counter.
+// The counting pipe can be rewound, if the wrapped pipe can be
+func NewCountingPipe(p Piper, counter Counter) Piper {
+	countingPipe := &CountingPipe{Piper: p, counter: counter}
+
+	if _, ok := p.(Rewinder); ok {
+		return &rewindableCountingPipe{CountingPipe: countingPipe}
+	}
+
+	return countingPipe
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"io"
 	"strings"
+
+	"github.com/FirinKinuo/capyback/bytesize"
 )
 
 // Type defines the type of the pipe
@@ -17,6 +19,11 @@ var (
 const (
 	// InMemoryPipeType is a pipe type that uses in-memory storage
 	InMemoryPipeType Type = "in-memory"
+	// SpoolPipeType is a pipe type that buffers data into a temporary file, so it can be read again
+	SpoolPipeType Type = "spool"
+
+	// fileSpoolPipeType is an alias of SpoolPipeType
+	fileSpoolPipeType Type = "file"
 )
 
 // String method returns the string representation of the Type
@@ -36,6 +43,8 @@ func (t *Type) UnmarshalText(text []byte) error {
 	switch s {
 	case InMemoryPipeType.String():
 		*t = InMemoryPipeType
+	case SpoolPipeType.String(), fileSpoolPipeType.String():
+		*t = SpoolPipeType
 	default:
 		// return an error if the provided text does not match a known Type
 		return UndefinedPipeErr
@@ -53,11 +62,39 @@ type Piper interface {
 	CloseReadWithErr(err error)
 }
 
-// NewPipe function returns a new Piper of the provided pipeType, or an error if the pipeType is not defined
+// Set method sets the Type from a flag value
+func (t *Type) Set(value string) error {
+	return t.UnmarshalText([]byte(value))
+}
+
+// Type method returns the name of the Type flag value
+func (t *Type) Type() string {
+	return "pipe-type"
+}
+
+// NewPipe function returns a new Piper of the provided pipeType, or an error if the pipeType is not defined.
+// A spool pipe is created in the default directory for temporary files without size limit
 func NewPipe(pipeType Type) (Piper, error) {
-	switch pipeType {
-	case InMemoryPipeType:
+	return Config{Type: pipeType}.ReadPipe()
+}
+
+// Config describes the pipe between the archiver and the storage
+type Config struct {
+	Type Type `yaml:"type"`
+	// Directory is a directory of spool files, the default directory for temporary files is used when it is empty.
+	// A stream archived in an archive format is spooled into the directory too
+	Directory string `yaml:"directory"`
+	// MaxSize limits the size of a spool file and of a spooled stream, zero means no limit
+	MaxSize bytesize.Size `yaml:"max-size"`
+}
+
+// ReadPipe returns a new Piper of the config, the in-memory pipe is used when the type is empty
+func (c Config) ReadPipe() (Piper, error) {
+	switch c.Type {
+	case InMemoryPipeType, "":
 		return NewInMemoryPipe(), nil
+	case SpoolPipeType:
+		return NewSpoolPipe(c.Directory, int64(c.MaxSize))
 	default:
 		return nil, UndefinedPipeErr
 	}
@@ -0,0 +1,167 @@
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const spoolFilePattern = ".capyback-spool-*"
+
+// ErrorSpoolFull is the error that is returned when the spooled data exceeds the max size of the spool
+var ErrorSpoolFull = errors.New("spool max size exceeded")
+
+// Rewinder is implemented by pipes which keep written data, so the reader can start over
+type Rewinder interface {
+	Rewind() error
+}
+
+// SpoolPipe describes a pipe that buffers written data into a temporary file.
+// The reader follows the writer, and it can be rewound to read the data again, e.g. to retry an upload
+type SpoolPipe struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	file    *os.File
+	maxSize int64
+
+	written int64 // written is the size of data written to the file
+	offset  int64 // offset is the position of the reader in the file
+
+	writeClosed bool
+	writeErr    error // writeErr is returned by the reader after the written data
+	readClosed  bool
+	readErr     error // readErr is returned by the writer after the reader end is closed
+}
+
+// NewSpoolPipe initializes and returns a new pipe spooled into a temporary file in the directory.
+// The default directory for temporary files is used when the directory is empty, maxSize <= 0 means no limit
+func NewSpoolPipe(directory string, maxSize int64) (*SpoolPipe, error) {
+	file, err := os.CreateTemp(directory, spoolFilePattern)
+	if err != nil {
+		return nil, fmt.Errorf("create spool file: %w", err)
+	}
+
+	sp := &SpoolPipe{
+		file:    file,
+		maxSize: maxSize,
+	}
+	sp.cond = sync.NewCond(&sp.mu)
+
+	return sp, nil
+}
+
+// Write writes to the spool file, it fails when the reader end is closed or the max size is exceeded
+func (sp *SpoolPipe) Write(p []byte) (n int, err error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	switch {
+	case sp.readClosed:
+		return 0, sp.readErr
+	case sp.writeClosed:
+		return 0, io.ErrClosedPipe
+	case sp.maxSize > 0 && sp.written+int64(len(p)) > sp.maxSize:
+		return 0, fmt.Errorf("%w: %d bytes", ErrorSpoolFull, sp.maxSize)
+	}
+
+	n, err = sp.file.WriteAt(p, sp.written)
+	sp.written += int64(n)
+	sp.cond.Broadcast()
+
+	return n, err
+}
+
+// Read reads the spooled data, it waits for the writer while all written data is read
+func (sp *SpoolPipe) Read(p []byte) (n int, err error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for sp.offset == sp.written && !sp.writeClosed && !sp.readClosed {
+		sp.cond.Wait()
+	}
+
+	switch {
+	case sp.readClosed:
+		return 0, io.ErrClosedPipe
+	case sp.offset == sp.written:
+		return 0, sp.writeErr
+	}
+
+	if available := sp.written - sp.offset; int64(len(p)) > available {
+		p = p[:available]
+	}
+
+	n, err = sp.file.ReadAt(p, sp.offset)
+	sp.offset += int64(n)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+
+	return n, err
+}
+
+// Rewind moves the reader to the start of the spooled data
+func (sp *SpoolPipe) Rewind() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.readClosed {
+		return io.ErrClosedPipe
+	}
+
+	sp.offset = 0
+
+	return nil
+}
+
+// CloseWrite closes the pipe's writer end
+func (sp *SpoolPipe) CloseWrite() {
+	sp.CloseWriteWithErr(nil)
+}
+
+// CloseRead closes the pipe's reader end and removes the spool file
+func (sp *SpoolPipe) CloseRead() {
+	sp.CloseReadWithErr(nil)
+}
+
+// CloseWriteWithErr closes the pipe's writer end and associates an error with it
+func (sp *SpoolPipe) CloseWriteWithErr(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.writeClosed {
+		return
+	}
+
+	sp.writeClosed = true
+	sp.writeErr = err
+	sp.cond.Broadcast()
+}
+
+// CloseReadWithErr closes the pipe's reader end, associates an error with it and removes the spool file
+func (sp *SpoolPipe) CloseReadWithErr(err error) {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.readClosed {
+		return
+	}
+
+	sp.readClosed = true
+	sp.readErr = err
+	sp.cond.Broadcast()
+
+	_ = sp.file.Close()
+	_ = os.Remove(sp.file.Name())
+}
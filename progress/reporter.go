@@ -0,0 +1,278 @@
+package progress
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FirinKinuo/capyback/bytesize"
+
+	"github.com/charmbracelet/log"
+	"github.com/mattn/go-isatty"
+)
+
+// Mode is the way progress is reported.
+type Mode string
+
+const (
+	// AutoMode renders a progress bar on a terminal and logs progress lines otherwise.
+	AutoMode Mode = "auto"
+	// BarMode renders a progress bar.
+	BarMode Mode = "bar"
+	// LogMode logs progress lines periodically.
+	LogMode Mode = "log"
+	// NoneMode does not report progress.
+	NoneMode Mode = "none"
+)
+
+const (
+	// DefaultLogInterval is the interval of progress lines in LogMode.
+	DefaultLogInterval = 30 * time.Second
+
+	// clearLine moves the cursor to the start of the line and clears it.
+	clearLine = "\r\033[K"
+
+	barInterval  = 200 * time.Millisecond
+	barWidth     = 24
+	maxFileWidth = 40
+)
+
+// ErrorUnknownMode is an error when the progress mode is not supported.
+var ErrorUnknownMode = errors.New("unknown progress mode, available: auto, bar, log, none")
+
+// String returns the string representation of the Mode.
+func (m Mode) String() string {
+	return string(m)
+}
+
+// UnmarshalText sets the Mode from its text representation.
+func (m *Mode) UnmarshalText(text []byte) error {
+	switch Mode(strings.ToLower(string(text))) {
+	case AutoMode, BarMode, LogMode, NoneMode:
+		*m = Mode(strings.ToLower(string(text)))
+	default:
+		return fmt.Errorf("%w: %q", ErrorUnknownMode, text)
+	}
+
+	return nil
+}
+
+// Set sets the Mode from a flag value.
+func (m *Mode) Set(value string) error {
+	return m.UnmarshalText([]byte(value))
+}
+
+// Type returns the name of the Mode flag value.
+func (m *Mode) Type() string {
+	return "progress-mode"
+}
+
+// Reporter periodically reports progress of the tracker to stderr.
+// While the progress bar is rendered, log lines are written above it.
+type Reporter struct {
+	tracker     *Tracker
+	mode        Mode
+	logInterval time.Duration
+
+	// mu guards output, so the bar and log lines are not interleaved.
+	mu     sync.Mutex
+	output io.Writer
+	bar    string
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// NewReporter creates a Reporter of the tracker, AutoMode is resolved by whether stderr is a terminal.
+func NewReporter(tracker *Tracker, mode Mode, logInterval time.Duration) *Reporter {
+	if mode == AutoMode || mode == "" {
+		mode = LogMode
+		if isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd()) {
+			mode = BarMode
+		}
+	}
+
+	if logInterval <= 0 {
+		logInterval = DefaultLogInterval
+	}
+
+	return &Reporter{tracker: tracker, mode: mode, logInterval: logInterval, output: os.Stderr}
+}
+
+// Start starts the time of the tracker and reporting.
+func (r *Reporter) Start() {
+	r.tracker.Start()
+
+	if r.mode == NoneMode {
+		return
+	}
+
+	interval := r.logInterval
+	if r.mode == BarMode {
+		interval = barInterval
+	}
+
+	if r.mode == BarMode {
+		log.SetOutput(&barLogOutput{reporter: r})
+	}
+
+	r.stop = make(chan struct{})
+	r.done.Add(1)
+
+	go func() {
+		defer r.done.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.report()
+			}
+		}
+	}()
+}
+
+// Stop stops reporting, clears the progress bar and logs the final progress.
+func (r *Reporter) Stop() {
+	if r.stop == nil {
+		return
+	}
+
+	close(r.stop)
+	r.done.Wait()
+	r.stop = nil
+
+	if r.mode == BarMode {
+		r.mu.Lock()
+		_, _ = fmt.Fprint(r.output, clearLine)
+		r.bar = ""
+		r.mu.Unlock()
+
+		log.SetOutput(r.output)
+	}
+
+	r.log("Progress completed")
+}
+
+func (r *Reporter) report() {
+	if r.mode == BarMode {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.bar = r.renderBar()
+		_, _ = fmt.Fprint(r.output, clearLine+r.bar)
+
+		return
+	}
+
+	r.log("Progress")
+}
+
+// barLogOutput writes log lines over the progress bar and draws the bar again below them.
+type barLogOutput struct {
+	reporter *Reporter
+}
+
+func (o *barLogOutput) Write(p []byte) (int, error) {
+	r := o.reporter
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, _ = fmt.Fprint(r.output, clearLine)
+
+	n, err := r.output.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	_, _ = fmt.Fprint(r.output, r.bar)
+
+	return n, nil
+}
+
+// log logs the progress as a structured line.
+func (r *Reporter) log(message string) {
+	stats := r.tracker.Stats()
+
+	keyvals := []any{
+		"files", stats.Files,
+		"read", bytesize.Size(stats.Source),
+		"archived", bytesize.Size(stats.Archived),
+		"uploaded", bytesize.Size(stats.Uploaded),
+		"throughput", bytesize.Size(stats.Throughput()).String() + "/s",
+		"elapsed", stats.Elapsed.Round(time.Second),
+	}
+
+	if percent, ok := stats.Percent(); ok {
+		keyvals = append(keyvals, "total", bytesize.Size(stats.Total), "percent", fmt.Sprintf("%.1f", percent))
+	}
+
+	if eta, ok := stats.ETA(); ok {
+		keyvals = append(keyvals, "eta", eta.Round(time.Second))
+	}
+
+	if stats.CurrentFile != "" {
+		keyvals = append(keyvals, "file", stats.CurrentFile)
+	}
+
+	log.Info(message, keyvals...)
+}
+
+// renderBar renders the progress as a single line with a bar, the bar is shown when the total is known.
+func (r *Reporter) renderBar() string {
+	stats := r.tracker.Stats()
+
+	var line strings.Builder
+
+	if percent, ok := stats.Percent(); ok {
+		filled := int(percent / 100 * barWidth)
+		fmt.Fprintf(
+			&line,
+			"[%s%s] %5.1f%% %s/%s ",
+			strings.Repeat("=", filled),
+			strings.Repeat(" ", barWidth-filled),
+			percent,
+			bytesize.Size(stats.Source),
+			bytesize.Size(stats.Total),
+		)
+	} else {
+		fmt.Fprintf(&line, "%s read ", bytesize.Size(stats.Source))
+	}
+
+	fmt.Fprintf(
+		&line,
+		"| %s uploaded | %s/s | %d files",
+		bytesize.Size(stats.Uploaded),
+		bytesize.Size(stats.Throughput()),
+		stats.Files,
+	)
+
+	if eta, ok := stats.ETA(); ok {
+		fmt.Fprintf(&line, " | ETA %s", eta.Round(time.Second))
+	}
+
+	if stats.CurrentFile != "" {
+		fmt.Fprintf(&line, " | %s", shorten(stats.CurrentFile, maxFileWidth))
+	}
+
+	return line.String()
+}
+
+// shorten keeps the end of the name, which is the most specific part of a path.
+func shorten(name string, width int) string {
+	runes := []rune(name)
+	if len(runes) <= width {
+		return name
+	}
+
+	return "..." + string(runes[len(runes)-width+3:])
+}
@@ -0,0 +1,134 @@
+package progress
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tracker counts progress of a backup: source files read by the archiver,
+// archive written to the pipe and uploaded from it. It is safe for concurrent use.
+type Tracker struct {
+	total    atomic.Int64
+	source   atomic.Int64
+	archived atomic.Int64
+	uploaded atomic.Int64
+	files    atomic.Int64
+
+	mu          sync.Mutex
+	start       time.Time
+	currentFile string
+}
+
+// NewTracker creates a Tracker, its time starts with Start.
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// Start starts the time of the backup.
+func (t *Tracker) Start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.start = time.Now()
+}
+
+// SetTotal sets the size of source files found by a scan before archiving, it is used to estimate the time left.
+func (t *Tracker) SetTotal(size int64) {
+	t.total.Store(size)
+}
+
+// StartFile counts the file, which the archiver starts to read.
+func (t *Tracker) StartFile(name string) {
+	t.files.Add(1)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.currentFile = name
+}
+
+// AddSource counts data read from source files.
+func (t *Tracker) AddSource(n int64) {
+	t.source.Add(n)
+}
+
+// AddWritten counts the archive written to the pipe.
+func (t *Tracker) AddWritten(n int64) {
+	t.archived.Add(n)
+}
+
+// AddRead counts the archive read from the pipe by the storage.
+func (t *Tracker) AddRead(n int64) {
+	t.uploaded.Add(n)
+}
+
+// ResetRead starts counting of the upload over, when it is retried.
+func (t *Tracker) ResetRead() {
+	t.uploaded.Store(0)
+}
+
+// Stats returns the progress so far.
+func (t *Tracker) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var elapsed time.Duration
+	if !t.start.IsZero() {
+		elapsed = time.Since(t.start)
+	}
+
+	return Stats{
+		Elapsed:     elapsed,
+		Total:       t.total.Load(),
+		Source:      t.source.Load(),
+		Archived:    t.archived.Load(),
+		Uploaded:    t.uploaded.Load(),
+		Files:       t.files.Load(),
+		CurrentFile: t.currentFile,
+	}
+}
+
+// Stats is progress of a backup at a moment.
+type Stats struct {
+	Elapsed time.Duration
+	// Total is the size of source files, zero when it is unknown, e.g. for a stream.
+	Total int64
+	// Source is the size of source files read, Archived is the size of the archive, Uploaded is the size uploaded.
+	Source   int64
+	Archived int64
+	Uploaded int64
+
+	Files       int64
+	CurrentFile string
+}
+
+// Throughput returns uploaded bytes per second.
+func (s Stats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(s.Uploaded) / s.Elapsed.Seconds()
+}
+
+// Percent returns the part of source files read in percent, it is false when the total is unknown.
+func (s Stats) Percent() (float64, bool) {
+	if s.Total <= 0 {
+		return 0, false
+	}
+
+	return min(float64(s.Source)/float64(s.Total)*100, 100), true
+}
+
+// ETA estimates the time left from the rate of reading source files, it is false when it can not be estimated yet.
+func (s Stats) ETA() (time.Duration, bool) {
+	if s.Total <= 0 || s.Source <= 0 || s.Elapsed <= 0 {
+		return 0, false
+	}
+
+	left := max(s.Total-s.Source, 0)
+	rate := float64(s.Source) / s.Elapsed.Seconds()
+
+	return time.Duration(float64(left) / rate * float64(time.Second)), true
+}
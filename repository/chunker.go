@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// gear maps every byte to a random number for the rolling hash.
+// The table is generated from a fixed seed, because chunk boundaries of the same content must never change.
+var gear = newGear(0x63617079626163b)
+
+func newGear(seed uint64) [256]uint64 {
+	var table [256]uint64
+
+	// splitmix64
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+
+	return table
+}
+
+// Chunker splits a stream into content-defined chunks with the gear rolling hash (FastCDC).
+// A boundary depends only on the last bytes before it, so an insertion into the stream
+// changes chunks around it, and the following chunks stay the same.
+// Chunks smaller than the average size are cut with a stricter mask, larger ones with a looser mask,
+// which keeps chunk sizes close to the average.
+type Chunker struct {
+	reader io.Reader
+
+	buffer     []byte
+	start, end int
+	eof        bool
+
+	minSize, avgSize, maxSize int
+	strictMask, looseMask     uint64
+}
+
+// NewChunker creates a Chunker of the reader, the average size must be a power of two.
+func NewChunker(reader io.Reader, minSize int, avgSize int, maxSize int) *Chunker {
+	avgBits := bits.TrailingZeros(uint(avgSize))
+
+	return &Chunker{
+		reader:     reader,
+		buffer:     make([]byte, 2*maxSize),
+		minSize:    minSize,
+		avgSize:    avgSize,
+		maxSize:    maxSize,
+		strictMask: highBitsMask(avgBits + 1),
+		looseMask:  highBitsMask(avgBits - 1),
+	}
+}
+
+// highBitsMask returns a mask of n high bits, which depend on the last 64 bytes of the rolling hash.
+func highBitsMask(n int) uint64 {
+	if n <= 0 {
+		return 0
+	}
+
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk or io.EOF after the last one.
+// The chunk is valid only until the next call.
+func (c *Chunker) Next() ([]byte, error) {
+	err := c.fill()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+
+	size := c.boundary(c.buffer[c.start:c.end])
+	chunk := c.buffer[c.start : c.start+size]
+	c.start += size
+
+	return chunk, nil
+}
+
+// fill reads the stream until the buffer holds a max size chunk or the stream ends.
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= c.maxSize {
+		return nil
+	}
+
+	c.end = copy(c.buffer, c.buffer[c.start:c.end])
+	c.start = 0
+
+	for c.end < len(c.buffer) {
+		n, err := c.reader.Read(c.buffer[c.end:])
+		c.end += n
+
+		if errors.Is(err, io.EOF) {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// boundary returns the size of the chunk at the start of data.
+func (c *Chunker) boundary(data []byte) int {
+	size := len(data)
+	if size <= c.minSize {
+		return size
+	}
+
+	if size > c.maxSize {
+		size = c.maxSize
+	}
+
+	normalSize := c.avgSize
+	if normalSize > size {
+		normalSize = size
+	}
+
+	var hash uint64
+	i := c.minSize
+
+	for ; i < normalSize; i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.strictMask == 0 {
+			return i + 1
+		}
+	}
+
+	for ; i < size; i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.looseMask == 0 {
+			return i + 1
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+const (
+	testMinChunkSize = 1024
+	testAvgChunkSize = 4096
+	testMaxChunkSize = 16384
+)
+
+// testContent returns random content, the same for the same seed.
+func testContent(seed int64, size int) []byte {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(content)
+
+	return content
+}
+
+// chunks splits the content with test chunk sizes and returns copies of the chunks.
+func chunks(t *testing.T, content []byte) [][]byte {
+	t.Helper()
+
+	chunker := NewChunker(bytes.NewReader(content), testMinChunkSize, testAvgChunkSize, testMaxChunkSize)
+
+	var result [][]byte
+	for {
+		chunk, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			return result
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+
+		result = append(result, append([]byte(nil), chunk...))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		// wantChunks is the number of chunks, -1 if it depends on the content.
+		wantChunks int
+	}{
+		{name: "empty", size: 0, wantChunks: 0},
+		{name: "smaller than min", size: testMinChunkSize - 1, wantChunks: 1},
+		{name: "several chunks", size: 64 * testAvgChunkSize, wantChunks: -1},
+		{name: "larger than the buffer", size: 4*testMaxChunkSize + 123, wantChunks: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := testContent(1, tt.size)
+			result := chunks(t, content)
+
+			if tt.wantChunks >= 0 && len(result) != tt.wantChunks {
+				t.Fatalf("got %d chunks, want %d", len(result), tt.wantChunks)
+			}
+
+			for i, chunk := range result {
+				if len(chunk) > testMaxChunkSize {
+					t.Errorf("chunk %d size %d is larger than max %d", i, len(chunk), testMaxChunkSize)
+				}
+
+				if i < len(result)-1 && len(chunk) < testMinChunkSize {
+					t.Errorf("chunk %d size %d is smaller than min %d", i, len(chunk), testMinChunkSize)
+				}
+			}
+
+			if joined := bytes.Join(result, nil); !bytes.Equal(joined, content) {
+				t.Errorf("chunks join into %d bytes, which differ from the %d bytes of content", len(joined), len(content))
+			}
+		})
+	}
+}
+
+func TestChunkerBoundariesAreContentDefined(t *testing.T) {
+	content := testContent(2, 64*testAvgChunkSize)
+
+	original := chunks(t, content)
+
+	if repeated := chunks(t, content); len(repeated) != len(original) {
+		t.Fatalf("the same content gives %d and %d chunks", len(original), len(repeated))
+	}
+
+	// An insertion at the start changes chunks around it only
+	shifted := chunks(t, append([]byte("inserted bytes"), content...))
+
+	known := make(map[string]bool, len(original))
+	for _, chunk := range original {
+		known[string(chunk)] = true
+	}
+
+	var reused int
+	for _, chunk := range shifted {
+		if known[string(chunk)] {
+			reused++
+		}
+	}
+
+	if reused < len(original)-2 {
+		t.Errorf("%d of %d chunks are reused after an insertion, want at least %d", reused, len(original), len(original)-2)
+	}
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FirinKinuo/capyback/bytesize"
+)
+
+// DefaultFormat is the archive format of backups in the repository.
+// The archive is not compressed, so unchanged files give the same chunks, chunks are compressed instead.
+const DefaultFormat = "tar"
+
+const (
+	defaultMinChunkSize = 512 * bytesize.KiB
+	defaultAvgChunkSize = 1 * bytesize.MiB
+	defaultMaxChunkSize = 8 * bytesize.MiB
+
+	defaultGracePeriod = 24 * time.Hour
+)
+
+var (
+	// ErrorInvalidChunkSize is an error when chunk sizes of the config can not be used for chunking.
+	ErrorInvalidChunkSize = errors.New(
+		"chunk sizes must satisfy 0 < min <= avg <= max, and avg must be a power of two",
+	)
+	// ErrorExpiringObjects is an error when the storage deletes objects after some time,
+	// chunks and keys shared by backups would expire with the first backup, which wrote them.
+	ErrorExpiringObjects = errors.New("objects of the repository must not expire, remove delete-after and delete-at of the storage")
+)
+
+// Config describes the deduplicated repository.
+// Chunk sizes are zero unless set, ChunkSizes returns them with defaults.
+// Chunks shared by backups must outlive every backup, so a storage with object expiry is rejected.
+type Config struct {
+	Enabled      bool          `yaml:"enabled"`
+	MinChunkSize bytesize.Size `yaml:"min-chunk-size,omitempty"`
+	AvgChunkSize bytesize.Size `yaml:"avg-chunk-size,omitempty"`
+	MaxChunkSize bytesize.Size `yaml:"max-chunk-size,omitempty"`
+	// GracePeriod protects unreferenced chunks younger than it from removal,
+	// they may belong to a backup which is being saved at the same time.
+	GracePeriod time.Duration `yaml:"grace-period,omitempty"`
+}
+
+// ChunkSizes returns min, average and max chunk sizes, unset sizes are replaced with defaults.
+func (c *Config) ChunkSizes() (minSize int, avgSize int, maxSize int, err error) {
+	minSize, avgSize, maxSize = int(defaultMinChunkSize), int(defaultAvgChunkSize), int(defaultMaxChunkSize)
+
+	if c.MinChunkSize != 0 {
+		minSize = int(c.MinChunkSize)
+	}
+
+	if c.AvgChunkSize != 0 {
+		avgSize = int(c.AvgChunkSize)
+	}
+
+	if c.MaxChunkSize != 0 {
+		maxSize = int(c.MaxChunkSize)
+	}
+
+	if minSize <= 0 || minSize > avgSize || avgSize > maxSize || avgSize&(avgSize-1) != 0 {
+		return 0, 0, 0, fmt.Errorf("%w: min %d, avg %d, max %d", ErrorInvalidChunkSize, minSize, avgSize, maxSize)
+	}
+
+	return minSize, avgSize, maxSize, nil
+}
+
+func (c *Config) gracePeriod() time.Duration {
+	if c.GracePeriod == 0 {
+		return defaultGracePeriod
+	}
+
+	return c.GracePeriod
+}
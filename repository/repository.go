@@ -0,0 +1,688 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FirinKinuo/capyback/bytesize"
+	"github.com/FirinKinuo/capyback/crypt"
+	"github.com/FirinKinuo/capyback/storage"
+
+	"github.com/charmbracelet/log"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ageHeader starts every age encrypted object, so encrypted objects are recognized on read.
+var ageHeader = []byte("age-encryption.org/v1\n")
+
+// KeyPrefix is the prefix of names of repository key objects.
+const KeyPrefix = "keys/"
+
+const (
+	// keyName is the name of the repository key identity, encrypted with the configured encryption.
+	keyName = KeyPrefix + "repository.age"
+	// keyRecipientName is the name of the repository key recipient, it is not encrypted,
+	// so backups are written with the configured recipients only.
+	keyRecipientName = KeyPrefix + "repository.pub"
+)
+
+var (
+	// ErrorEncryptedObject is an error when an encrypted object of the repository is read without a decrypter.
+	ErrorEncryptedObject = errors.New("repository object is encrypted, an identity or a passphrase is required")
+	// ErrorCorruptedChunk is an error when the chunk content does not match its hash.
+	ErrorCorruptedChunk = errors.New("chunk content does not match its hash")
+	// ErrorInvalidChunkHash is an error when a snapshot references a chunk by an invalid hash.
+	ErrorInvalidChunkHash = errors.New("invalid chunk hash")
+)
+
+// Repository is a storage of deduplicated backups on top of another storage.
+// A written backup is split into content-defined chunks, every chunk is stored once as a compressed object
+// and the backup is stored as a snapshot, which lists its chunks. Backups are read, listed and deleted by names
+// like in any other storage, chunks are hidden, and chunks no longer referenced are removed by Collect.
+// With an encrypter chunks and snapshots are encrypted to the repository key, which is created on the first
+// encrypted write and stored encrypted with the encrypter, so a passphrase is derived once and not for every chunk.
+// Chunk names are hashes of unencrypted content.
+type Repository struct {
+	storage storage.Storager
+	config  *storage.Config
+
+	minSize, avgSize, maxSize int
+	gracePeriod               time.Duration
+
+	encrypter crypt.Encrypter
+	decrypter crypt.Decrypter
+
+	// keyEncrypter and keyDecrypter encrypt and decrypt objects with the repository key, they are read on first use.
+	keyEncrypter crypt.Encrypter
+	keyDecrypter crypt.Decrypter
+
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+
+	mu sync.Mutex
+	// chunks are hashes of stored chunks, they are listed before the first write.
+	chunks map[string]bool
+}
+
+// NewRepository creates a Repository in the storage, storageConfig provides params of stored objects.
+func NewRepository(s storage.Storager, storageConfig *storage.Config, config *Config) (*Repository, error) {
+	minSize, avgSize, maxSize, err := config.ChunkSizes()
+	if err != nil {
+		return nil, err
+	}
+
+	expires, err := storageConfig.Expires()
+	if err != nil {
+		return nil, fmt.Errorf("read write params: %w", err)
+	}
+
+	if expires {
+		return nil, ErrorExpiringObjects
+	}
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("create zstd encoder: %w", err)
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("create zstd decoder: %w", err)
+	}
+
+	return &Repository{
+		storage:     s,
+		config:      storageConfig,
+		minSize:     minSize,
+		avgSize:     avgSize,
+		maxSize:     maxSize,
+		gracePeriod: config.gracePeriod(),
+		encoder:     encoder,
+		decoder:     decoder,
+	}, nil
+}
+
+// SetEncrypter enables encryption of written chunks and snapshots.
+func (r *Repository) SetEncrypter(e crypt.Encrypter) {
+	r.encrypter = e
+}
+
+// SetDecrypter enables reading of encrypted chunks and snapshots.
+func (r *Repository) SetDecrypter(d crypt.Decrypter) {
+	r.decrypter = d
+}
+
+func (r *Repository) Authenticate(ctx context.Context) error {
+	return r.storage.Authenticate(ctx)
+}
+
+// Write splits the content into chunks, writes chunks missing in the storage and the snapshot of the backup.
+func (r *Repository) Write(ctx context.Context, content io.Reader, params storage.WriteParams) error {
+	chunks, err := r.storedChunks(ctx)
+	if err != nil {
+		return err
+	}
+
+	chunker := NewChunker(content, r.minSize, r.avgSize, r.maxSize)
+	snapshot := &Snapshot{Created: time.Now().UTC()}
+
+	var newChunks int
+	var uploaded int64
+
+	for {
+		chunk, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read content: %w", err)
+		}
+
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		snapshot.add(hash, len(chunk))
+
+		if chunks[hash] {
+			continue
+		}
+
+		size, err := r.writeChunk(ctx, hash, chunk)
+		if err != nil {
+			return fmt.Errorf("write chunk %s: %w", hash, err)
+		}
+
+		r.mu.Lock()
+		chunks[hash] = true
+		r.mu.Unlock()
+
+		newChunks++
+		uploaded += size
+	}
+
+	encodedSnapshot, err := r.seal(ctx, snapshot.Write)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	// The checksum of the content describes the backup, the snapshot object is written with a checksum of its own
+	backupName := params.Name()
+	params.SetName(SnapshotName(backupName))
+	snapshotChecksum := storage.NewContentChecksum(encodedSnapshot)
+	params.SetChecksum(snapshotChecksum)
+	params.SetSize(int64(len(encodedSnapshot)))
+	defer params.SetName(backupName)
+
+	err = r.storage.Write(ctx, snapshotChecksum, params)
+	if err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	log.Info(
+		"Snapshot written",
+		"name", backupName,
+		"size", bytesize.Size(snapshot.Size),
+		"chunks", len(snapshot.Chunks),
+		"new", newChunks,
+		"uploaded", bytesize.Size(uploaded),
+	)
+
+	return nil
+}
+
+// storedChunks returns hashes of chunks in the storage, they are listed once and updated on writes.
+func (r *Repository) storedChunks(ctx context.Context) (map[string]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.chunks != nil {
+		return r.chunks, nil
+	}
+
+	objects, err := r.list(ctx, ChunkPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("list chunks: %w", err)
+	}
+
+	r.chunks = make(map[string]bool, len(objects))
+	for _, object := range objects {
+		if IsChunk(object.Name) {
+			r.chunks[path.Base(object.Name)] = true
+		}
+	}
+
+	return r.chunks, nil
+}
+
+// writeChunk compresses, encrypts and writes the chunk, it returns the size of the written object.
+func (r *Repository) writeChunk(ctx context.Context, hash string, chunk []byte) (int64, error) {
+	compressedChunk := r.encoder.EncodeAll(chunk, nil)
+
+	encodedChunk, err := r.seal(ctx, func(out io.Writer) error {
+		_, err := out.Write(compressedChunk)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.writeObject(ctx, ChunkName(hash), encodedChunk)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(encodedChunk)), nil
+}
+
+// exists reports whether the object exists in the storage.
+func (r *Repository) exists(ctx context.Context, name string) (bool, error) {
+	objectParams, err := r.config.ReadObjectParams()
+	if err != nil {
+		return false, fmt.Errorf("read object params: %w", err)
+	}
+	objectParams.SetName(name)
+
+	_, err = r.storage.Stat(ctx, objectParams)
+	if errors.Is(err, storage.ErrorObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *Repository) writeObject(ctx context.Context, name string, content []byte) error {
+	writeParams, err := r.config.ReadWriteParams()
+	if err != nil {
+		return fmt.Errorf("read write params: %w", err)
+	}
+	checksum := storage.NewContentChecksum(content)
+	writeParams.SetName(name)
+	writeParams.SetChecksum(checksum)
+	writeParams.SetSize(int64(len(content)))
+
+	return r.storage.Write(ctx, checksum, writeParams)
+}
+
+// Read reads the snapshot of the backup and writes its chunks to out.
+func (r *Repository) Read(ctx context.Context, out io.Writer, params storage.ObjectParams) error {
+	snapshot, err := r.readSnapshot(ctx, params.Name())
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range snapshot.Chunks {
+		content, err := r.readChunk(ctx, chunk.Hash)
+		if err != nil {
+			return fmt.Errorf("read chunk %s: %w", chunk.Hash, err)
+		}
+
+		_, err = out.Write(content)
+		if err != nil {
+			return fmt.Errorf("write chunk %s: %w", chunk.Hash, err)
+		}
+	}
+
+	return nil
+}
+
+// readSnapshot reads the snapshot of the backup.
+func (r *Repository) readSnapshot(ctx context.Context, backupName string) (*Snapshot, error) {
+	encodedSnapshot, err := r.readObject(ctx, SnapshotName(backupName))
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot of %s: %w", backupName, err)
+	}
+
+	snapshotReader, err := r.open(ctx, encodedSnapshot)
+	if err != nil {
+		return nil, fmt.Errorf("open snapshot of %s: %w", backupName, err)
+	}
+
+	snapshot, err := ReadSnapshot(snapshotReader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", backupName, err)
+	}
+
+	return snapshot, nil
+}
+
+// readChunk reads, decrypts and decompresses the chunk, the content is checked against the hash.
+func (r *Repository) readChunk(ctx context.Context, hash string) ([]byte, error) {
+	decodedHash, err := hex.DecodeString(hash)
+	if err != nil || len(decodedHash) != sha256.Size {
+		return nil, fmt.Errorf("%w: %q", ErrorInvalidChunkHash, hash)
+	}
+
+	encodedChunk, err := r.readObject(ctx, ChunkName(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	chunkReader, err := r.open(ctx, encodedChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	compressedChunk, err := io.ReadAll(chunkReader)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	chunk, err := r.decoder.DecodeAll(compressedChunk, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+
+	sum := sha256.Sum256(chunk)
+	if !bytes.Equal(sum[:], decodedHash) {
+		return nil, ErrorCorruptedChunk
+	}
+
+	return chunk, nil
+}
+
+func (r *Repository) readObject(ctx context.Context, name string) ([]byte, error) {
+	objectParams, err := r.config.ReadObjectParams()
+	if err != nil {
+		return nil, fmt.Errorf("read object params: %w", err)
+	}
+	objectParams.SetName(name)
+
+	var content bytes.Buffer
+
+	err = r.storage.Read(ctx, &content, objectParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return content.Bytes(), nil
+}
+
+// List lists backups in the repository, they are snapshots named without the snapshot suffix.
+// Sizes of listed backups are sizes of their snapshots, checksums of snapshots are not reported.
+func (r *Repository) List(ctx context.Context, params storage.ListParams) ([]storage.Object, error) {
+	objects, err := r.storage.List(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]storage.Object, 0, len(objects))
+	for _, object := range objects {
+		if !IsSnapshot(object.Name) {
+			continue
+		}
+
+		object.Name = object.Name[:len(object.Name)-len(SnapshotSuffix)]
+		backups = append(backups, snapshotObject(object))
+	}
+
+	return backups, nil
+}
+
+// Delete deletes the snapshot of the backup, its chunks are removed by Collect.
+func (r *Repository) Delete(ctx context.Context, params storage.ObjectParams) error {
+	backupName := params.Name()
+	params.SetName(SnapshotName(backupName))
+	defer params.SetName(backupName)
+
+	return r.storage.Delete(ctx, params)
+}
+
+// Stat returns the snapshot object of the backup named as the backup.
+func (r *Repository) Stat(ctx context.Context, params storage.ObjectParams) (storage.Object, error) {
+	backupName := params.Name()
+	params.SetName(SnapshotName(backupName))
+	defer params.SetName(backupName)
+
+	object, err := r.storage.Stat(ctx, params)
+	if err != nil {
+		return storage.Object{}, err
+	}
+
+	object.Name = backupName
+
+	return snapshotObject(object), nil
+}
+
+// snapshotObject removes checksums of the snapshot object, they do not describe the content of the backup,
+// which is verified by hashes of its chunks.
+func snapshotObject(object storage.Object) storage.Object {
+	object.Hash = ""
+
+	if _, ok := object.Metadata[storage.MetadataSha256]; ok {
+		metadata := make(map[string]string, len(object.Metadata))
+		for key, value := range object.Metadata {
+			if key != storage.MetadataSha256 {
+				metadata[key] = value
+			}
+		}
+
+		object.Metadata = metadata
+	}
+
+	return object
+}
+
+// Collect removes chunks which are not referenced by any snapshot and are older than the grace period.
+// All snapshots are read, so encrypted snapshots require a decrypter. With dryRun chunks are only logged,
+// and snapshots of removed backups, which a dry run does not delete, are not counted as references.
+func (r *Repository) Collect(ctx context.Context, removed []string, dryRun bool) error {
+	objects, err := r.list(ctx, "")
+	if err != nil {
+		return fmt.Errorf("list repository: %w", err)
+	}
+
+	removedSnapshots := make(map[string]bool, len(removed))
+	for _, backupName := range removed {
+		removedSnapshots[SnapshotName(backupName)] = true
+	}
+
+	referenced := make(map[string]bool)
+
+	for _, object := range objects {
+		if !IsSnapshot(object.Name) || removedSnapshots[object.Name] {
+			continue
+		}
+
+		snapshot, err := r.readSnapshot(ctx, object.Name[:len(object.Name)-len(SnapshotSuffix)])
+		if err != nil {
+			return err
+		}
+
+		for _, chunk := range snapshot.Chunks {
+			referenced[chunk.Hash] = true
+		}
+	}
+
+	cutoff := time.Now().Add(-r.gracePeriod)
+
+	var removedChunks int
+	var removedSize int64
+
+	for _, object := range objects {
+		if !IsChunk(object.Name) || referenced[path.Base(object.Name)] || object.LastModified.After(cutoff) {
+			continue
+		}
+
+		if dryRun {
+			log.Info("Would remove chunk", "name", object.Name, "size", bytesize.Size(object.Size))
+		} else {
+			err = r.deleteObject(ctx, object.Name)
+			if err != nil {
+				return fmt.Errorf("remove chunk %s: %w", object.Name, err)
+			}
+
+			r.mu.Lock()
+			delete(r.chunks, path.Base(object.Name))
+			r.mu.Unlock()
+		}
+
+		removedChunks++
+		removedSize += object.Size
+	}
+
+	log.Info("Unreferenced chunks collected", "chunks", removedChunks, "size", bytesize.Size(removedSize), "dry-run", dryRun)
+
+	return nil
+}
+
+func (r *Repository) list(ctx context.Context, prefix string) ([]storage.Object, error) {
+	listParams, err := r.config.ReadListParams()
+	if err != nil {
+		return nil, fmt.Errorf("read list params: %w", err)
+	}
+	listParams.SetPrefix(prefix)
+
+	return r.storage.List(ctx, listParams)
+}
+
+func (r *Repository) deleteObject(ctx context.Context, name string) error {
+	objectParams, err := r.config.ReadObjectParams()
+	if err != nil {
+		return fmt.Errorf("read object params: %w", err)
+	}
+	objectParams.SetName(name)
+
+	return r.storage.Delete(ctx, objectParams)
+}
+
+// seal returns content written by write, encrypted with the repository key if an encrypter is set.
+func (r *Repository) seal(ctx context.Context, write func(out io.Writer) error) ([]byte, error) {
+	var content bytes.Buffer
+
+	encrypter, err := r.objectEncrypter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read repository key: %w", err)
+	}
+
+	if encrypter == nil {
+		err = write(&content)
+		if err != nil {
+			return nil, err
+		}
+
+		return content.Bytes(), nil
+	}
+
+	err = encrypt(encrypter, &content, write)
+	if err != nil {
+		return nil, err
+	}
+
+	return content.Bytes(), nil
+}
+
+// open returns a reader of the object content, decrypted with the repository key if the object is encrypted.
+func (r *Repository) open(ctx context.Context, content []byte) (io.Reader, error) {
+	if !bytes.HasPrefix(content, ageHeader) {
+		return bytes.NewReader(content), nil
+	}
+
+	decrypter, err := r.objectDecrypter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read repository key: %w", err)
+	}
+
+	decryptedContent, err := decrypter.Decrypt(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("start decryption: %w", err)
+	}
+
+	return decryptedContent, nil
+}
+
+// objectEncrypter returns the encrypter of the repository key, or nil if encryption is not enabled.
+// The repository key is created, if there is none.
+func (r *Repository) objectEncrypter(ctx context.Context) (crypt.Encrypter, error) {
+	if r.encrypter == nil {
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.keyEncrypter != nil {
+		return r.keyEncrypter, nil
+	}
+
+	exists, err := r.exists(ctx, keyRecipientName)
+	if err != nil {
+		return nil, err
+	}
+
+	var recipient []byte
+	if exists {
+		recipient, err = r.readObject(ctx, keyRecipientName)
+	} else {
+		recipient, err = r.createKey(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.keyEncrypter, err = crypt.NewRecipientEncrypter(strings.TrimSpace(string(recipient)))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.keyEncrypter, nil
+}
+
+// objectDecrypter returns the decrypter of the repository key, the key is decrypted with the decrypter.
+func (r *Repository) objectDecrypter(ctx context.Context) (crypt.Decrypter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.keyDecrypter != nil {
+		return r.keyDecrypter, nil
+	}
+
+	if r.decrypter == nil {
+		return nil, ErrorEncryptedObject
+	}
+
+	encryptedIdentity, err := r.readObject(ctx, keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	identityReader, err := r.decrypter.Decrypt(bytes.NewReader(encryptedIdentity))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	identity, err := io.ReadAll(identityReader)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	r.keyDecrypter, err = crypt.NewIdentityDecrypter(strings.TrimSpace(string(identity)))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.keyDecrypter, nil
+}
+
+// createKey generates the repository key and writes it encrypted with the encrypter, it returns the key recipient.
+// The recipient is written last, so it exists only together with the identity.
+func (r *Repository) createKey(ctx context.Context) ([]byte, error) {
+	identity, recipient, err := crypt.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var encryptedIdentity bytes.Buffer
+
+	err = encrypt(r.encrypter, &encryptedIdentity, func(out io.Writer) error {
+		_, err := io.WriteString(out, identity+"\n")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.writeObject(ctx, keyName, encryptedIdentity.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("write key: %w", err)
+	}
+
+	err = r.writeObject(ctx, keyRecipientName, []byte(recipient+"\n"))
+	if err != nil {
+		return nil, fmt.Errorf("write key recipient: %w", err)
+	}
+
+	log.Info("Repository key created")
+
+	return []byte(recipient), nil
+}
+
+// encrypt writes content written by write to out, encrypted with the encrypter.
+func encrypt(encrypter crypt.Encrypter, out io.Writer, write func(out io.Writer) error) error {
+	encryptedOut, err := encrypter.Encrypt(out)
+	if err != nil {
+		return fmt.Errorf("start encryption: %w", err)
+	}
+
+	err = write(encryptedOut)
+	if err != nil {
+		return err
+	}
+
+	err = encryptedOut.Close()
+	if err != nil {
+		return fmt.Errorf("finish encryption: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/FirinKinuo/capyback/bytesize"
+	"github.com/FirinKinuo/capyback/storage"
+)
+
+// newTestRepository returns a repository in a temporary local storage with test chunk sizes.
+func newTestRepository(t *testing.T) (*Repository, *storage.Config, storage.Storager) {
+	t.Helper()
+
+	storageConfig := &storage.Config{
+		StorageType:   storage.LocalStorageType,
+		StorageParams: map[string]any{"directory": t.TempDir()},
+	}
+
+	localStorage, err := storageConfig.ReadStorage()
+	if err != nil {
+		t.Fatalf("read storage: %v", err)
+	}
+
+	repository, err := NewRepository(localStorage, storageConfig, &Config{
+		Enabled:      true,
+		MinChunkSize: testMinChunkSize * bytesize.Byte,
+		AvgChunkSize: testAvgChunkSize * bytesize.Byte,
+		MaxChunkSize: testMaxChunkSize * bytesize.Byte,
+	})
+	if err != nil {
+		t.Fatalf("new repository: %v", err)
+	}
+
+	return repository, storageConfig, localStorage
+}
+
+func TestRepositoryDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	repository, storageConfig, localStorage := newTestRepository(t)
+
+	content := testContent(3, 64*testAvgChunkSize)
+	changed := append(append([]byte(nil), content[:len(content)/2]...), []byte("changed")...)
+	changed = append(changed, content[len(content)/2:]...)
+
+	tests := []struct {
+		name    string
+		content []byte
+		// maxNewChunks is the max number of chunks added to the storage by the backup.
+		maxNewChunks int
+	}{
+		{name: "first", content: content, maxNewChunks: len(content)/testMinChunkSize + 1},
+		{name: "same", content: content, maxNewChunks: 0},
+		{name: "changed in the middle", content: changed, maxNewChunks: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := countChunks(t, localStorage, storageConfig)
+
+			writeParams, err := storageConfig.ReadWriteParams()
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeParams.SetName(tt.name)
+
+			err = repository.Write(ctx, bytes.NewReader(tt.content), writeParams)
+			if err != nil {
+				t.Fatalf("write: %v", err)
+			}
+
+			if added := countChunks(t, localStorage, storageConfig) - before; added > tt.maxNewChunks {
+				t.Errorf("backup added %d chunks, want at most %d", added, tt.maxNewChunks)
+			}
+
+			objectParams, err := storageConfig.ReadObjectParams()
+			if err != nil {
+				t.Fatal(err)
+			}
+			objectParams.SetName(tt.name)
+
+			var out bytes.Buffer
+			err = repository.Read(ctx, &out, objectParams)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+
+			if !bytes.Equal(out.Bytes(), tt.content) {
+				t.Errorf("read %d bytes, which differ from the written %d bytes", out.Len(), len(tt.content))
+			}
+		})
+	}
+
+	listParams, err := storageConfig.ReadListParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := repository.List(ctx, listParams)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	if len(backups) != len(tests) {
+		t.Errorf("listed %d backups, want %d", len(backups), len(tests))
+	}
+}
+
+func countChunks(t *testing.T, s storage.Storager, storageConfig *storage.Config) int {
+	t.Helper()
+
+	listParams, err := storageConfig.ReadListParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listParams.SetPrefix(ChunkPrefix)
+
+	objects, err := s.List(context.Background(), listParams)
+	if err != nil {
+		t.Fatalf("list chunks: %v", err)
+	}
+
+	return len(objects)
+}
+
+func TestNewRepositoryRejectsExpiringObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]any
+		wantErr error
+	}{
+		{name: "no expiry", params: map[string]any{"container": "backups"}},
+		{name: "delete after", params: map[string]any{"container": "backups", "delete-after": "720h"}, wantErr: ErrorExpiringObjects},
+		{name: "delete at", params: map[string]any{"delete-at": "2030-01-01T00:00:00Z"}, wantErr: ErrorExpiringObjects},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageConfig := &storage.Config{StorageType: storage.SwiftStorageType, StorageParams: tt.params}
+
+			_, err := NewRepository(nil, storageConfig, &Config{Enabled: true})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewRepository() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsInternal(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: ChunkName("ab" + string(bytes.Repeat([]byte("0"), 62))), want: true},
+		{name: keyName, want: true},
+		{name: keyRecipientName, want: true},
+		{name: SnapshotName("daily.tar.zst"), want: false},
+		{name: "daily.tar.zst", want: false},
+		{name: "backups/chunks/daily.tar.zst", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsInternal(tt.name); got != tt.want {
+				t.Errorf("IsInternal(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SnapshotSuffix is appended to the backup name to get the name of its snapshot object.
+const SnapshotSuffix = ".snapshot"
+
+// ChunkPrefix is the prefix of names of chunk objects.
+const ChunkPrefix = "chunks/"
+
+// Chunk is a reference to a chunk object, Hash is a hex sha256 of the chunk content.
+type Chunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// Snapshot is a backup in the repository, its content is the concatenation of Chunks.
+type Snapshot struct {
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+	Chunks  []Chunk   `json:"chunks"`
+}
+
+// SnapshotName returns the name of the snapshot object of the backup.
+func SnapshotName(backupName string) string {
+	return backupName + SnapshotSuffix
+}
+
+// IsSnapshot reports whether the object name is a name of a snapshot.
+func IsSnapshot(name string) bool {
+	return strings.HasSuffix(name, SnapshotSuffix) && !IsChunk(name)
+}
+
+// ChunkName returns the name of the chunk object, chunks are spread by the first byte of the hash.
+func ChunkName(hash string) string {
+	return ChunkPrefix + hash[:2] + "/" + hash
+}
+
+// IsChunk reports whether the object name is a name of a chunk.
+func IsChunk(name string) bool {
+	return strings.HasPrefix(name, ChunkPrefix)
+}
+
+// IsInternal reports whether the object name is a name of a chunk or a key, which are not backups.
+func IsInternal(name string) bool {
+	return IsChunk(name) || strings.HasPrefix(name, KeyPrefix)
+}
+
+// add appends the chunk to the snapshot.
+func (s *Snapshot) add(hash string, size int) {
+	s.Chunks = append(s.Chunks, Chunk{Hash: hash, Size: int64(size)})
+	s.Size += int64(size)
+}
+
+// Write writes the snapshot as gzipped json.
+func (s *Snapshot) Write(out io.Writer) error {
+	gzipWriter := gzip.NewWriter(out)
+
+	err := json.NewEncoder(gzipWriter).Encode(s)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	return gzipWriter.Close()
+}
+
+// ReadSnapshot reads the snapshot written by Snapshot.Write.
+func ReadSnapshot(in io.Reader) (*Snapshot, error) {
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("open gzip: %w", err)
+	}
+	defer gzipReader.Close()
+
+	snapshot := &Snapshot{}
+
+	err = json.NewDecoder(gzipReader).Decode(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
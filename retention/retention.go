@@ -0,0 +1,145 @@
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FirinKinuo/capyback/storage"
+)
+
+// Config describes retention of backups in storage.
+type Config struct {
+	// PruneAfterSave prunes backups after every successful save.
+	PruneAfterSave bool     `yaml:"prune-after-save"`
+	Policies       []Policy `yaml:"policies"`
+}
+
+// Policy is a set of rules which backups to keep, applied to backups which names start with Prefix.
+// A backup is kept if any of Keep rules selects it, when no Keep rule is set all backups are kept.
+// Backups older than MaxAge are removed regardless of Keep rules.
+// The newest backup is never removed.
+type Policy struct {
+	Prefix      string        `yaml:"prefix"`
+	KeepLast    int           `yaml:"keep-last"`
+	KeepDaily   int           `yaml:"keep-daily"`
+	KeepWeekly  int           `yaml:"keep-weekly"`
+	KeepMonthly int           `yaml:"keep-monthly"`
+	KeepYearly  int           `yaml:"keep-yearly"`
+	MaxAge      time.Duration `yaml:"max-age"`
+}
+
+// hasKeepRules reports whether any Keep rule is set.
+func (p *Policy) hasKeepRules() bool {
+	return p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0 || p.KeepYearly > 0
+}
+
+// bucketRule keeps the newest backup of each period, for up to count periods.
+type bucketRule struct {
+	count  int
+	period func(t time.Time) string
+}
+
+func (p *Policy) bucketRules() []bucketRule {
+	return []bucketRule{
+		{count: p.KeepDaily, period: func(t time.Time) string { return t.Format(time.DateOnly) }},
+		{count: p.KeepWeekly, period: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{count: p.KeepMonthly, period: func(t time.Time) string { return t.Format("2006-01") }},
+		{count: p.KeepYearly, period: func(t time.Time) string { return t.Format("2006") }},
+	}
+}
+
+// apply splits objects sorted from the newest to the oldest into kept and removed.
+func (p *Policy) apply(objects []storage.Object, now time.Time) (keep []storage.Object, remove []storage.Object) {
+	selected := make([]bool, len(objects))
+
+	if !p.hasKeepRules() {
+		for i := range selected {
+			selected[i] = true
+		}
+	}
+
+	for i := 0; i < p.KeepLast && i < len(objects); i++ {
+		selected[i] = true
+	}
+
+	for _, rule := range p.bucketRules() {
+		lastPeriod, kept := "", 0
+
+		for i, object := range objects {
+			if kept >= rule.count {
+				break
+			}
+
+			period := rule.period(object.LastModified.In(now.Location()))
+			if period == lastPeriod {
+				continue
+			}
+
+			selected[i] = true
+			lastPeriod = period
+			kept++
+		}
+	}
+
+	for i, object := range objects {
+		expired := p.MaxAge > 0 && now.Sub(object.LastModified) > p.MaxAge
+
+		if i == 0 || (selected[i] && !expired) {
+			keep = append(keep, object)
+		} else {
+			remove = append(remove, object)
+		}
+	}
+
+	return keep, remove
+}
+
+// Apply splits objects into kept and removed by policies.
+// Each object is handled by the policy with the longest matching prefix, objects without policy are kept.
+func Apply(policies []Policy, objects []storage.Object, now time.Time) (keep []storage.Object, remove []storage.Object) {
+	groups := make(map[int][]storage.Object, len(policies))
+
+	for _, object := range objects {
+		policyIndex := matchPolicy(policies, object.Name)
+		if policyIndex < 0 {
+			keep = append(keep, object)
+			continue
+		}
+
+		groups[policyIndex] = append(groups[policyIndex], object)
+	}
+
+	for policyIndex, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].LastModified.After(group[j].LastModified)
+		})
+
+		groupKeep, groupRemove := policies[policyIndex].apply(group, now)
+		keep = append(keep, groupKeep...)
+		remove = append(remove, groupRemove...)
+	}
+
+	return keep, remove
+}
+
+// matchPolicy returns an index of the policy with the longest prefix of name, or -1 if there is none.
+func matchPolicy(policies []Policy, name string) int {
+	matched := -1
+
+	for i, policy := range policies {
+		if !strings.HasPrefix(name, policy.Prefix) {
+			continue
+		}
+
+		if matched < 0 || len(policy.Prefix) > len(policies[matched].Prefix) {
+			matched = i
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,137 @@
+package retention
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/FirinKinuo/capyback/storage"
+)
+
+// testNow is a Sunday, the end of an ISO week.
+var testNow = time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC)
+
+// dailyObjects returns objects named prefix+N, one per day, N days before testNow.
+func dailyObjects(prefix string, days int) []storage.Object {
+	objects := make([]storage.Object, 0, days)
+
+	for day := 0; day < days; day++ {
+		objects = append(objects, storage.Object{
+			Name:         prefix + strconv.Itoa(day),
+			LastModified: testNow.AddDate(0, 0, -day),
+		})
+	}
+
+	return objects
+}
+
+func names(objects []storage.Object) []string {
+	result := make([]string, 0, len(objects))
+	for _, object := range objects {
+		result = append(result, object.Name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		policies   []Policy
+		objects    []storage.Object
+		wantRemove []string
+	}{
+		{
+			name:     "no keep rules keep everything",
+			policies: []Policy{{Prefix: "db-"}},
+			objects:  dailyObjects("db-", 5),
+		},
+		{
+			name:       "keep last",
+			policies:   []Policy{{Prefix: "db-", KeepLast: 2}},
+			objects:    dailyObjects("db-", 4),
+			wantRemove: []string{"db-2", "db-3"},
+		},
+		{
+			name:     "keep daily keeps the newest backup of a day",
+			policies: []Policy{{Prefix: "db-", KeepDaily: 2}},
+			objects: []storage.Object{
+				{Name: "db-morning", LastModified: testNow.Add(-6 * time.Hour)},
+				{Name: "db-noon", LastModified: testNow},
+				{Name: "db-yesterday", LastModified: testNow.AddDate(0, 0, -1)},
+				{Name: "db-old", LastModified: testNow.AddDate(0, 0, -2)},
+			},
+			wantRemove: []string{"db-morning", "db-old"},
+		},
+		{
+			name:     "keep weekly uses ISO weeks",
+			policies: []Policy{{Prefix: "db-", KeepWeekly: 2}},
+			// Backups of Sundays, 0 and 7 days ago, are the newest of their weeks
+			objects:    dailyObjects("db-", 14),
+			wantRemove: []string{"db-1", "db-10", "db-11", "db-12", "db-13", "db-2", "db-3", "db-4", "db-5", "db-6", "db-8", "db-9"},
+		},
+		{
+			name:     "keep monthly and yearly",
+			policies: []Policy{{Prefix: "db-", KeepMonthly: 2, KeepYearly: 2}},
+			objects: []storage.Object{
+				{Name: "db-mar", LastModified: testNow},
+				{Name: "db-mar-early", LastModified: testNow.AddDate(0, 0, -20)},
+				{Name: "db-feb", LastModified: time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC)},
+				{Name: "db-jan", LastModified: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)},
+				{Name: "db-last-year", LastModified: testNow.AddDate(-1, 0, 0)},
+				{Name: "db-two-years", LastModified: testNow.AddDate(-2, 0, 0)},
+			},
+			wantRemove: []string{"db-jan", "db-mar-early", "db-two-years"},
+		},
+		{
+			name:       "max age removes selected backups",
+			policies:   []Policy{{Prefix: "db-", KeepLast: 10, MaxAge: 48 * time.Hour}},
+			objects:    dailyObjects("db-", 4),
+			wantRemove: []string{"db-3"},
+		},
+		{
+			name:     "the newest backup is never removed",
+			policies: []Policy{{Prefix: "db-", MaxAge: time.Hour}},
+			objects: []storage.Object{
+				{Name: "db-new", LastModified: testNow.AddDate(0, 0, -1)},
+				{Name: "db-old", LastModified: testNow.AddDate(0, 0, -2)},
+			},
+			wantRemove: []string{"db-old"},
+		},
+		{
+			name:       "objects without policy are kept",
+			policies:   []Policy{{Prefix: "db-", KeepLast: 1}},
+			objects:    append(dailyObjects("db-", 2), dailyObjects("www-", 2)...),
+			wantRemove: []string{"db-1"},
+		},
+		{
+			name:       "the longest prefix wins",
+			policies:   []Policy{{Prefix: "", KeepLast: 1}, {Prefix: "db-", KeepLast: 3}},
+			objects:    append(dailyObjects("db-", 3), dailyObjects("www-", 3)...),
+			wantRemove: []string{"www-1", "www-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, remove := Apply(tt.policies, tt.objects, testNow)
+
+			if len(keep)+len(remove) != len(tt.objects) {
+				t.Fatalf("kept %d and removed %d of %d objects", len(keep), len(remove), len(tt.objects))
+			}
+
+			gotRemove := names(remove)
+			if len(gotRemove) != len(tt.wantRemove) {
+				t.Fatalf("removed %v, want %v", gotRemove, tt.wantRemove)
+			}
+
+			for i := range gotRemove {
+				if gotRemove[i] != tt.wantRemove[i] {
+					t.Fatalf("removed %v, want %v", gotRemove, tt.wantRemove)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Command returns a command, which runs the command line in the system shell.
+func Command(ctx context.Context, commandLine string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", commandLine)
+	}
+
+	return exec.CommandContext(ctx, "sh", "-c", commandLine)
+}
+
+// Output is the standard output of a running command.
+type Output struct {
+	io.ReadCloser
+
+	commandLine string
+	command     *exec.Cmd
+}
+
+// StartOutput runs the command line in the system shell and returns its standard output,
+// standard error of the command goes to stderr. The command is killed, when the context is done.
+func StartOutput(ctx context.Context, commandLine string) (*Output, error) {
+	command := Command(ctx, commandLine)
+	command.Stderr = os.Stderr
+
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("command %q: %w", commandLine, err)
+	}
+
+	err = command.Start()
+	if err != nil {
+		return nil, fmt.Errorf("start command %q: %w", commandLine, err)
+	}
+
+	return &Output{ReadCloser: stdout, commandLine: commandLine, command: command}, nil
+}
+
+// Close waits for the command to exit and returns an error, if the command failed.
+// The output is closed first, so a command, which is still writing, is not waited forever.
+func (o *Output) Close() error {
+	_ = o.ReadCloser.Close()
+
+	err := o.command.Wait()
+	if err != nil {
+		return fmt.Errorf("command %q: %w", o.commandLine, err)
+	}
+
+	return nil
+}
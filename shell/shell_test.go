@@ -0,0 +1,44 @@
+//go:build unix
+
+package shell
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestStartOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		commandLine string
+		want        string
+		wantErr     bool
+	}{
+		{name: "success", commandLine: "printf 'dump'", want: "dump"},
+		{name: "failure", commandLine: "printf 'part'; exit 2", want: "part", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := StartOutput(context.Background(), tt.commandLine)
+			if err != nil {
+				t.Fatalf("start: %v", err)
+			}
+
+			content, err := io.ReadAll(output)
+			if err != nil {
+				t.Fatalf("read output: %v", err)
+			}
+
+			if string(content) != tt.want {
+				t.Errorf("output = %q, want %q", content, tt.want)
+			}
+
+			err = output.Close()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("close error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/FirinKinuo/capyback/bytesize"
+
+	"github.com/charmbracelet/log"
+)
+
+// maxThrottledRead limits a single read of throttled content, so it is sent smoothly and not in bursts.
+const maxThrottledRead = 64 * 1024
+
+// ErrorInvalidTimeOfDay is an error when a time of day is not in HH:MM form.
+var ErrorInvalidTimeOfDay = errors.New("time of day must be in HH:MM form")
+
+// TimeOfDay is a local time of the day in minutes since midnight, written as "HH:MM".
+type TimeOfDay int
+
+// String returns the time of day as "HH:MM".
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t/60, t%60)
+}
+
+// MarshalText converts the TimeOfDay to a []byte.
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText converts "HH:MM" to a TimeOfDay.
+func (t *TimeOfDay) UnmarshalText(text []byte) error {
+	clock, err := time.Parse("15:04", string(text))
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrorInvalidTimeOfDay, text)
+	}
+
+	*t = TimeOfDay(clock.Hour()*60 + clock.Minute())
+
+	return nil
+}
+
+// BandwidthWindow is a part of the day with its own upload limit.
+type BandwidthWindow struct {
+	// From and To are local times of the day, a window which ends before it starts spans midnight.
+	From TimeOfDay `yaml:"from"`
+	To   TimeOfDay `yaml:"to"`
+	// Upload is the upload limit inside the window, zero means no limit.
+	Upload bytesize.Rate `yaml:"upload"`
+}
+
+// contains reports whether the local time is inside the window, including From and excluding To.
+func (w BandwidthWindow) contains(now time.Time) bool {
+	minute := TimeOfDay(now.Hour()*60 + now.Minute())
+
+	if w.From <= w.To {
+		return w.From <= minute && minute < w.To
+	}
+
+	return minute >= w.From || minute < w.To
+}
+
+// BandwidthConfig limits the rate of uploads to the storage, optionally by the time of day.
+type BandwidthConfig struct {
+	// Upload is the upload limit outside windows of the schedule, zero means no limit.
+	Upload bytesize.Rate `yaml:"upload,omitempty"`
+	// Schedule replaces the upload limit in windows of the day, the first window containing the time is used.
+	Schedule []BandwidthWindow `yaml:"schedule,omitempty"`
+}
+
+// Limited reports whether uploads are limited at any time of the day.
+func (c BandwidthConfig) Limited() bool {
+	if c.Upload > 0 {
+		return true
+	}
+
+	for _, window := range c.Schedule {
+		if window.Upload > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UploadRate returns the upload limit at the time, zero means no limit.
+func (c BandwidthConfig) UploadRate(now time.Time) bytesize.Rate {
+	for _, window := range c.Schedule {
+		if window.contains(now) {
+			return window.Upload
+		}
+	}
+
+	return c.Upload
+}
+
+// ThrottleStorage is a Storager, which limits the rate of content written to the wrapped storage with a token bucket.
+// The limit is checked during the upload, so a long upload follows the schedule.
+type ThrottleStorage struct {
+	Storager
+	bucket *tokenBucket
+}
+
+// NewThrottleStorage wraps the storage with the upload limit of the config.
+func NewThrottleStorage(storage Storager, config BandwidthConfig) *ThrottleStorage {
+	return &ThrottleStorage{Storager: storage, bucket: &tokenBucket{rate: config.UploadRate}}
+}
+
+func (t *ThrottleStorage) Write(ctx context.Context, content io.Reader, params WriteParams) error {
+	return t.Storager.Write(ctx, &throttledReader{ctx: ctx, reader: content, bucket: t.bucket}, params)
+}
+
+// throttledReader waits for the token bucket after every read of the content.
+type throttledReader struct {
+	ctx    context.Context
+	reader io.Reader
+	bucket *tokenBucket
+}
+
+func (r *throttledReader) Read(p []byte) (n int, err error) {
+	if len(p) > maxThrottledRead {
+		p = p[:maxThrottledRead]
+	}
+
+	n, err = r.reader.Read(p)
+
+	waitErr := r.bucket.wait(r.ctx, n)
+	if waitErr != nil {
+		return n, waitErr
+	}
+
+	return n, err
+}
+
+// tokenBucket is filled at the rate up to a second of the rate, which allows short bursts.
+// Bytes are taken after they are read, so the bucket can go into debt, which is paid by waiting.
+type tokenBucket struct {
+	mu sync.Mutex
+
+	rate     func(now time.Time) bytesize.Rate
+	lastRate bytesize.Rate
+	tokens   float64
+	last     time.Time
+}
+
+// wait takes n bytes from the bucket and waits until the bucket is not in debt.
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	delay := b.take(n)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// take takes n bytes from the bucket and returns the time to wait until the debt is paid.
+func (b *tokenBucket) take(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	rate := b.rate(now)
+
+	if rate != b.lastRate {
+		if rate > 0 {
+			log.Info("Upload bandwidth limited", "rate", rate)
+		} else {
+			log.Info("Upload bandwidth not limited")
+		}
+
+		b.lastRate = rate
+		b.tokens = 0
+		b.last = now
+	}
+
+	if rate <= 0 {
+		return 0
+	}
+
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*float64(rate), float64(rate))
+	b.last = now
+	b.tokens -= float64(n)
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / float64(rate) * float64(time.Second))
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ErrorChecksumMismatch is an error when the storage reports a checksum different from the uploaded content.
+var ErrorChecksumMismatch = errors.New("uploaded content does not match the checksum reported by storage")
+
+// Checksum hashes content with MD5 and SHA-256 while it is read, so checksums of a streamed backup
+// are known when the upload is complete. A storage compares the MD5 with the ETag of the uploaded object
+// and stores the SHA-256 in object metadata.
+type Checksum struct {
+	reader io.Reader
+
+	md5    hash.Hash
+	sha256 hash.Hash
+	size   int64
+
+	// contentSHA256 is the hex SHA-256 of content in memory, which is known before the upload.
+	contentSHA256 string
+
+	// partSize, when set, splits the content into parts of multipart upload to hash each of them.
+	partSize int64
+	partMD5  hash.Hash
+	partRead int64
+	partSums []byte
+}
+
+// NewChecksum returns a reader of the content, which hashes everything read.
+func NewChecksum(content io.Reader) *Checksum {
+	return &Checksum{
+		reader: content,
+		md5:    md5.New(),
+		sha256: sha256.New(),
+	}
+}
+
+// NewContentChecksum returns a rewindable reader of the content in memory, which SHA-256 is known before the upload,
+// so storages send it together with the object.
+func NewContentChecksum(content []byte) *Checksum {
+	checksum := NewChecksum(NewRewindableReader(content))
+
+	sum := sha256.Sum256(content)
+	checksum.contentSHA256 = hex.EncodeToString(sum[:])
+
+	return checksum
+}
+
+func (c *Checksum) Read(p []byte) (n int, err error) {
+	n, err = c.reader.Read(p)
+
+	c.md5.Write(p[:n])
+	c.sha256.Write(p[:n])
+	c.size += int64(n)
+	c.hashParts(p[:n])
+
+	return n, err
+}
+
+// splitParts makes the checksum hash parts of the given size, the way they are uploaded by multipart upload.
+func (c *Checksum) splitParts(partSize int64) {
+	c.partSize = partSize
+	c.partMD5 = md5.New()
+	c.partRead = 0
+	c.partSums = nil
+}
+
+// hashParts writes the content to the hash of the current part, starting a new part at the part size.
+func (c *Checksum) hashParts(p []byte) {
+	if c.partSize <= 0 {
+		return
+	}
+
+	for len(p) > 0 {
+		if c.partRead == c.partSize {
+			c.partSums = c.partMD5.Sum(c.partSums)
+			c.partMD5.Reset()
+			c.partRead = 0
+		}
+
+		n := min(int64(len(p)), c.partSize-c.partRead)
+		c.partMD5.Write(p[:n])
+		c.partRead += n
+		p = p[n:]
+	}
+}
+
+// multipartETag returns the ETag of the content uploaded in parts: MD5 of MD5 of the parts and the number of parts.
+func (c *Checksum) multipartETag() string {
+	sums := c.partMD5.Sum(c.partSums)
+	etag := md5.Sum(sums)
+
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(etag[:]), len(sums)/md5.Size)
+}
+
+// Rewind starts the content over for a retried upload and resets the hashes.
+func (c *Checksum) Rewind() error {
+	contentRewinder, ok := c.reader.(rewinder)
+	if !ok {
+		return ErrorContentNotRewindable
+	}
+
+	err := contentRewinder.Rewind()
+	if err != nil {
+		return err
+	}
+
+	c.md5.Reset()
+	c.sha256.Reset()
+	c.size = 0
+
+	if c.partSize > 0 {
+		c.splitParts(c.partSize)
+	}
+
+	return nil
+}
+
+// knownSHA256 returns the hex SHA-256 of the content known before the upload, it is empty for a stream.
+func (c *Checksum) knownSHA256() string {
+	return c.contentSHA256
+}
+
+// MD5 returns the hex MD5 of the content read so far.
+func (c *Checksum) MD5() string {
+	return hex.EncodeToString(c.md5.Sum(nil))
+}
+
+// SHA256 returns the hex SHA-256 of the content read so far.
+func (c *Checksum) SHA256() string {
+	return hex.EncodeToString(c.sha256.Sum(nil))
+}
+
+// Size returns the size of the content read so far.
+func (c *Checksum) Size() int64 {
+	return c.size
+}
+
+// VerifyETag compares the MD5 with the ETag of the uploaded object.
+// ETags of objects uploaded in parts are compared only when the checksum hashed the parts,
+// other ETags, which are not MD5 of the content, are not compared.
+func (c *Checksum) VerifyETag(etag string) error {
+	etag = strings.ToLower(strings.Trim(etag, "\""))
+
+	if strings.Contains(etag, "-") {
+		if c.partSize <= 0 {
+			return nil
+		}
+
+		if etag != c.multipartETag() {
+			return fmt.Errorf("%w: etag %s, multipart etag %s", ErrorChecksumMismatch, etag, c.multipartETag())
+		}
+
+		return nil
+	}
+
+	if len(etag) != md5.Size*2 {
+		return nil
+	}
+
+	if etag != c.MD5() {
+		return fmt.Errorf("%w: etag %s, md5 %s", ErrorChecksumMismatch, etag, c.MD5())
+	}
+
+	return nil
+}
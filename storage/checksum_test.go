@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// testMultipartETag returns the ETag S3 reports for the content uploaded in parts of the given size.
+func testMultipartETag(content []byte, partSize int) string {
+	var sums []byte
+	parts := 0
+
+	for start := 0; start == 0 || start < len(content); start += partSize {
+		sum := md5.Sum(content[start:min(start+partSize, len(content))])
+		sums = append(sums, sum[:]...)
+		parts++
+	}
+
+	return fmt.Sprintf("%s-%d", md5Hex(sums), parts)
+}
+
+func TestChecksumVerifyETag(t *testing.T) {
+	content := bytes.Repeat([]byte("capyback"), 100)
+	sum := md5.Sum(content)
+
+	tests := []struct {
+		name     string
+		partSize int64
+		etag     string
+		wantErr  error
+	}{
+		{name: "md5", etag: `"` + hex.EncodeToString(sum[:]) + `"`},
+		{name: "other md5", etag: md5Hex([]byte("other")), wantErr: ErrorChecksumMismatch},
+		{name: "not md5", etag: "abc"},
+		{name: "multipart of single part", partSize: 1000, etag: testMultipartETag(content, 1000)},
+		{name: "multipart of several parts", partSize: 256, etag: testMultipartETag(content, 256)},
+		{name: "multipart of exact parts", partSize: 400, etag: testMultipartETag(content, 400)},
+		{name: "multipart of other parts", partSize: 256, etag: testMultipartETag(content, 128), wantErr: ErrorChecksumMismatch},
+		{name: "multipart without parts", etag: testMultipartETag(content, 256)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checksum := NewChecksum(bytes.NewReader(content))
+			if tt.partSize > 0 {
+				checksum.splitParts(tt.partSize)
+			}
+
+			_, err := io.CopyBuffer(io.Discard, checksum, make([]byte, 100))
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+
+			err = checksum.VerifyETag(tt.etag)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyETag(%s) = %v, want %v", tt.etag, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -8,6 +8,21 @@ import (
 type Config struct {
 	StorageType   Type           `yaml:"type"`
 	StorageParams map[string]any `yaml:"params"`
+	Retry         RetryConfig    `yaml:"retry,omitempty"`
+	// Bandwidth limits uploads to the storage.
+	Bandwidth BandwidthConfig `yaml:"bandwidth,omitempty"`
+}
+
+// Copy returns a deep copy of the config, so its params can be changed independently.
+func (c *Config) Copy() (*Config, error) {
+	configCopy := &Config{StorageType: c.StorageType, Retry: c.Retry, Bandwidth: c.Bandwidth}
+
+	err := configCopy.MergeParams(c.StorageParams)
+	if err != nil {
+		return nil, fmt.Errorf("copy params: %w", err)
+	}
+
+	return configCopy, nil
 }
 
 func (c *Config) convertParamsMapTo(to any) error {
@@ -24,7 +39,55 @@ func (c *Config) convertParamsMapTo(to any) error {
 	return nil
 }
 
+// ReadStorage returns the storage of the config, which retries failed operations.
+// Uploads are throttled inside retries, if the bandwidth is limited.
 func (c *Config) ReadStorage() (Storager, error) {
+	storager, err := c.readStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Bandwidth.Limited() {
+		storager = NewThrottleStorage(storager, c.Bandwidth)
+	}
+
+	return NewRetryStorage(storager, c.Retry), nil
+}
+
+// Target returns where the storage keeps backups: the directory, the container or the bucket.
+func (c *Config) Target() string {
+	target := struct {
+		Directory string `yaml:"directory"`
+		Container string `yaml:"container"`
+		Bucket    string `yaml:"bucket"`
+	}{}
+
+	// Params are checked when the storage is read, a target of invalid params is unknown
+	_ = c.convertParamsMapTo(&target)
+
+	switch c.StorageType {
+	case SwiftStorageType:
+		return target.Container
+	case S3StorageType:
+		return target.Bucket
+	default:
+		return target.Directory
+	}
+}
+
+// Expires reports whether the storage deletes written objects after some time.
+func (c *Config) Expires() (bool, error) {
+	writeParams, err := c.ReadWriteParams()
+	if err != nil {
+		return false, err
+	}
+
+	swiftWriteParams, ok := writeParams.(*SwiftWriteParams)
+
+	return ok && swiftWriteParams.expires(), nil
+}
+
+func (c *Config) readStorage() (Storager, error) {
 	switch c.StorageType {
 	case SwiftStorageType:
 		swiftStorageConfig := &SwiftStorageConfig{}
@@ -36,6 +99,26 @@ func (c *Config) ReadStorage() (Storager, error) {
 
 		return NewSwiftStorage(swiftStorageConfig), nil
 
+	case LocalStorageType:
+		localStorageConfig := &LocalStorageConfig{}
+
+		err := c.convertParamsMapTo(localStorageConfig)
+		if err != nil {
+			return nil, fmt.Errorf("convert params map: %w", err)
+		}
+
+		return NewLocalStorage(localStorageConfig), nil
+
+	case S3StorageType:
+		s3StorageConfig := &S3StorageConfig{}
+
+		err := c.convertParamsMapTo(s3StorageConfig)
+		if err != nil {
+			return nil, fmt.Errorf("convert params map: %w", err)
+		}
+
+		return NewS3Storage(s3StorageConfig), nil
+
 	default:
 		return nil, UndefinedStorageTypeErr
 	}
@@ -53,6 +136,79 @@ func (c *Config) ReadWriteParams() (WriteParams, error) {
 
 		return swiftWriteParams, nil
 
+	case LocalStorageType:
+		return &LocalWriteParams{}, nil
+
+	case S3StorageType:
+		s3WriteParams := &S3WriteParams{}
+
+		err := c.convertParamsMapTo(s3WriteParams)
+		if err != nil {
+			return nil, fmt.Errorf("convert params map: %w", err)
+		}
+
+		return s3WriteParams, nil
+
+	default:
+		return nil, UndefinedStorageTypeErr
+	}
+}
+
+func (c *Config) ReadObjectParams() (ObjectParams, error) {
+	switch c.StorageType {
+	case SwiftStorageType:
+		swiftObjectParams := &SwiftObjectParams{}
+
+		err := c.convertParamsMapTo(swiftObjectParams)
+		if err != nil {
+			return nil, fmt.Errorf("convert params map: %w", err)
+		}
+
+		return swiftObjectParams, nil
+
+	case LocalStorageType:
+		return &LocalObjectParams{}, nil
+
+	case S3StorageType:
+		s3ObjectParams := &S3ObjectParams{}
+
+		err := c.convertParamsMapTo(s3ObjectParams)
+		if err != nil {
+			return nil, fmt.Errorf("convert params map: %w", err)
+		}
+
+		return s3ObjectParams, nil
+
+	default:
+		return nil, UndefinedStorageTypeErr
+	}
+}
+
+func (c *Config) ReadListParams() (ListParams, error) {
+	switch c.StorageType {
+	case SwiftStorageType:
+		swiftListParams := &SwiftListParams{}
+
+		err := c.convertParamsMapTo(swiftListParams)
+		if err != nil {
+			return nil, fmt.Errorf("convert params map: %w", err)
+		}
+
+		return swiftListParams, nil
+
+	case LocalStorageType:
+		return &LocalListParams{}, nil
+
+	case S3StorageType:
+		s3ListParams := &S3ListParams{}
+
+		err := c.convertParamsMapTo(s3ListParams)
+		if err != nil {
+			return nil, fmt.Errorf("convert params map: %w", err)
+		}
+
+		return s3ListParams, nil
+
 	default:
 		return nil, UndefinedStorageTypeErr
 	}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envStorageType = "CAPYBACK_STORAGE"
+
+// environReader reads storage params from environment variables.
+// Only the set variables are read, so the rest of params stay untouched.
+type environReader interface {
+	ReadFromEnviron() error
+}
+
+// setFromEnviron sets value from the environment variable, if it is set and not empty.
+func setFromEnviron(value *string, key string) {
+	environValue := os.Getenv(key)
+	if environValue != "" {
+		*value = environValue
+	}
+}
+
+// ReadFromEnviron overrides the storage type and params with environment variables.
+func (c *Config) ReadFromEnviron() error {
+	environType := os.Getenv(envStorageType)
+	if environType != "" {
+		err := c.StorageType.Set(environType)
+		if err != nil {
+			return fmt.Errorf("%s: %w", envStorageType, err)
+		}
+	}
+
+	return c.ReadParamsFromEnviron()
+}
+
+// ReadParamsFromEnviron overrides params of the current storage type with environment variables.
+func (c *Config) ReadParamsFromEnviron() error {
+	var environParams environReader
+
+	switch c.StorageType {
+	case SwiftStorageType:
+		environParams = &swiftEnviron{}
+	case LocalStorageType:
+		environParams = &LocalStorageConfig{}
+	case S3StorageType:
+		environParams = &s3Environ{}
+	default:
+		return nil
+	}
+
+	err := environParams.ReadFromEnviron()
+	if err != nil {
+		return fmt.Errorf("read environ: %w", err)
+	}
+
+	err = c.MergeParams(environParams)
+	if err != nil {
+		return fmt.Errorf("merge environ params: %w", err)
+	}
+
+	return nil
+}
+
+// MergeParams overrides params with non-empty fields of the yaml tagged struct or map.
+// Maps, like metadata, are merged key by key, so a layer overrides only the keys it sets.
+func (c *Config) MergeParams(params any) error {
+	yamlParams, err := yaml.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("marshal yaml: %w", err)
+	}
+
+	paramsMap := make(map[string]any)
+
+	err = yaml.Unmarshal(yamlParams, &paramsMap)
+	if err != nil {
+		return fmt.Errorf("unmarshal yaml: %w", err)
+	}
+
+	if c.StorageParams == nil {
+		c.StorageParams = make(map[string]any, len(paramsMap))
+	}
+
+	mergeParamsMap(c.StorageParams, paramsMap)
+
+	return nil
+}
+
+// mergeParamsMap copies params into the destination, nested maps are merged into existing maps.
+func mergeParamsMap(destination map[string]any, params map[string]any) {
+	for key, value := range params {
+		valueMap, isMap := value.(map[string]any)
+		destinationMap, isDestinationMap := destination[key].(map[string]any)
+
+		if isMap && isDestinationMap {
+			mergeParamsMap(destinationMap, valueMap)
+			continue
+		}
+
+		destination[key] = value
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigMergeParams(t *testing.T) {
+	config := &Config{
+		StorageType: SwiftStorageType,
+		StorageParams: map[string]any{
+			"container": "backups",
+			"metadata":  map[string]any{"owner": "ops", "env": "dev"},
+		},
+	}
+
+	err := config.MergeParams(struct {
+		Container string            `yaml:"container,omitempty"`
+		Metadata  map[string]string `yaml:"metadata,omitempty"`
+	}{Metadata: map[string]string{"env": "prod", "team": "db"}})
+	if err != nil {
+		t.Fatalf("merge params: %v", err)
+	}
+
+	want := map[string]any{
+		"container": "backups",
+		"metadata":  map[string]any{"owner": "ops", "env": "prod", "team": "db"},
+	}
+	if !reflect.DeepEqual(config.StorageParams, want) {
+		t.Errorf("params = %v, want %v", config.StorageParams, want)
+	}
+
+	configCopy, err := config.Copy()
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+
+	configCopy.StorageParams["metadata"].(map[string]any)["env"] = "test"
+	if config.StorageParams["metadata"].(map[string]any)["env"] != "prod" {
+		t.Errorf("change of the copy changed params of the config: %v", config.StorageParams)
+	}
+}
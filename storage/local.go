@@ -0,0 +1,492 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	localTempFilePrefix = ".capyback-"
+	localTempFileSuffix = ".tmp"
+	// localChecksumFileSuffix is a suffix of a file next to the object with its SHA-256 in the format of sha256sum.
+	localChecksumFileSuffix = ".sha256"
+)
+
+const (
+	defaultLocalFilePermissions      Permissions = 0640
+	defaultLocalDirectoryPermissions Permissions = 0750
+)
+
+// ErrorUnsafeObjectName is an error when an object name points outside the storage directory.
+var ErrorUnsafeObjectName = errors.New("object name points outside the storage directory")
+
+// Permissions is a file mode that can be written in yaml both as an octal number (0640) and an octal string ("0640").
+type Permissions os.FileMode
+
+// UnmarshalYAML parses permissions from yaml node.
+func (p *Permissions) UnmarshalYAML(node *yaml.Node) error {
+	if node.Tag == "!!int" {
+		var mode uint32
+		err := node.Decode(&mode)
+		if err != nil {
+			return fmt.Errorf("decode permissions: %w", err)
+		}
+
+		*p = Permissions(mode)
+		return nil
+	}
+
+	mode, err := strconv.ParseUint(strings.TrimPrefix(node.Value, "0o"), 8, 32)
+	if err != nil {
+		return fmt.Errorf("parse permissions %q: %w", node.Value, err)
+	}
+
+	*p = Permissions(mode)
+	return nil
+}
+
+// MarshalYAML writes permissions to yaml as an octal string.
+func (p Permissions) MarshalYAML() (any, error) {
+	return fmt.Sprintf("%#o", uint32(p)), nil
+}
+
+// FileMode returns permissions as os.FileMode.
+func (p Permissions) FileMode() os.FileMode {
+	return os.FileMode(p).Perm()
+}
+
+const envLocalStorageDirectory = "LOCAL_STORAGE_DIRECTORY"
+
+type LocalStorageConfig struct {
+	Directory            string      `yaml:"directory,omitempty"`
+	FilePermissions      Permissions `yaml:"file-permissions,omitempty"`
+	DirectoryPermissions Permissions `yaml:"directory-permissions,omitempty"`
+}
+
+// ReadFromEnviron overrides the config with the set environment variables.
+func (l *LocalStorageConfig) ReadFromEnviron() error {
+	setFromEnviron(&l.Directory, envLocalStorageDirectory)
+
+	return nil
+}
+
+type LocalWriteParams struct {
+	ObjectName string `yaml:"-"`
+
+	checksum *Checksum
+}
+
+func (l *LocalWriteParams) Name() string {
+	return l.ObjectName
+}
+
+func (l *LocalWriteParams) SetName(name string) {
+	l.ObjectName = name
+}
+
+// SetMetadata does nothing, files in the local storage have no metadata.
+func (l *LocalWriteParams) SetMetadata(_ map[string]string) {}
+
+// SetChecksum sets the checksum, the SHA-256 of a streamed backup is written to a file next to the object,
+// which can be checked with sha256sum. Content in memory, like chunks and indexes, gets no file.
+func (l *LocalWriteParams) SetChecksum(checksum *Checksum) {
+	l.checksum = checksum
+}
+
+// SetSize does nothing, files are written as they are read.
+func (l *LocalWriteParams) SetSize(_ int64) {}
+
+type LocalObjectParams struct {
+	ObjectName string `yaml:"-"`
+}
+
+func (l *LocalObjectParams) Name() string {
+	return l.ObjectName
+}
+
+func (l *LocalObjectParams) SetName(name string) {
+	l.ObjectName = name
+}
+
+type LocalListParams struct {
+	Prefix       string `yaml:"-"`
+	WithMetadata bool   `yaml:"-"`
+}
+
+func (l *LocalListParams) SetPrefix(prefix string) {
+	l.Prefix = prefix
+}
+
+// SetWithMetadata makes the listing read the SHA-256 of every object.
+func (l *LocalListParams) SetWithMetadata(withMetadata bool) {
+	l.WithMetadata = withMetadata
+}
+
+// LocalStorage stores backups as files in a directory of the local filesystem.
+type LocalStorage struct {
+	directory            string
+	filePermissions      os.FileMode
+	directoryPermissions os.FileMode
+}
+
+func NewLocalStorage(config *LocalStorageConfig) *LocalStorage {
+	filePermissions := config.FilePermissions
+	if filePermissions == 0 {
+		filePermissions = defaultLocalFilePermissions
+	}
+
+	directoryPermissions := config.DirectoryPermissions
+	if directoryPermissions == 0 {
+		directoryPermissions = defaultLocalDirectoryPermissions
+	}
+
+	return &LocalStorage{
+		directory:            config.Directory,
+		filePermissions:      filePermissions.FileMode(),
+		directoryPermissions: directoryPermissions.FileMode(),
+	}
+}
+
+// Authenticate makes sure the storage directory exists and is a directory.
+func (l *LocalStorage) Authenticate(_ context.Context) error {
+	if l.directory == "" {
+		return errors.New("storage directory is not specified")
+	}
+
+	err := os.MkdirAll(l.directory, l.directoryPermissions)
+	if err != nil {
+		return fmt.Errorf("make storage dir: %w", err)
+	}
+
+	return nil
+}
+
+func (l *LocalStorage) Write(ctx context.Context, content io.Reader, params WriteParams) error {
+	localParams, ok := params.(*LocalWriteParams)
+	if !ok {
+		return errors.New("params is not of type *LocalWriteParams")
+	}
+
+	err := l.writeFile(ctx, content, localParams.ObjectName)
+	if err != nil {
+		return fmt.Errorf("write to local storage: %w", err)
+	}
+
+	if localParams.checksum == nil || localParams.checksum.knownSHA256() != "" {
+		err = l.removeChecksumFile(localParams.ObjectName)
+		if err != nil {
+			return fmt.Errorf("write to local storage: %w", err)
+		}
+
+		return nil
+	}
+
+	err = l.writeChecksumFile(localParams.ObjectName, localParams.checksum.SHA256())
+	if err != nil {
+		return fmt.Errorf("write to local storage: %w", err)
+	}
+
+	return nil
+}
+
+// writeFile writes content into a temporary file next to the destination and renames it,
+// so a partially written backup never appears under the final name.
+func (l *LocalStorage) writeFile(ctx context.Context, content io.Reader, objectName string) error {
+	destination, err := l.objectPath(objectName)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(destination), l.directoryPermissions)
+	if err != nil {
+		return fmt.Errorf("make object dir: %w", err)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(destination), localTempFilePrefix+"*"+localTempFileSuffix)
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+	}()
+
+	_, err = io.Copy(tempFile, &contextReader{ctx: ctx, reader: content})
+	if err != nil {
+		return fmt.Errorf("copy content: %w", err)
+	}
+
+	err = tempFile.Sync()
+	if err != nil {
+		return fmt.Errorf("sync temp file: %w", err)
+	}
+
+	err = tempFile.Chmod(l.filePermissions)
+	if err != nil {
+		return fmt.Errorf("chmod temp file: %w", err)
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+
+	err = os.Rename(tempFile.Name(), destination)
+	if err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+
+	return nil
+}
+
+// writeChecksumFile writes the SHA-256 of the object next to it in the format of sha256sum.
+func (l *LocalStorage) writeChecksumFile(objectName string, sha256 string) error {
+	line := fmt.Sprintf("%s  %s\n", sha256, path.Base(objectName))
+
+	err := l.writeFile(context.Background(), strings.NewReader(line), objectName+localChecksumFileSuffix)
+	if err != nil {
+		return fmt.Errorf("write checksum file: %w", err)
+	}
+
+	return nil
+}
+
+// removeChecksumFile removes the SHA-256 of the object, which may be left by a previous object of the name.
+func (l *LocalStorage) removeChecksumFile(objectName string) error {
+	objectPath, err := l.objectPath(objectName)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(objectPath + localChecksumFileSuffix)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove checksum file: %w", err)
+	}
+
+	return nil
+}
+
+// readMetadata returns metadata of the object with the SHA-256 from the file next to it, nil if there is no file.
+func (l *LocalStorage) readMetadata(objectPath string) (map[string]string, error) {
+	line, err := os.ReadFile(objectPath + localChecksumFileSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checksum file: %w", err)
+	}
+
+	sha256, _, _ := strings.Cut(string(line), " ")
+
+	return map[string]string{MetadataSha256: strings.TrimSpace(sha256)}, nil
+}
+
+func (l *LocalStorage) Read(ctx context.Context, out io.Writer, params ObjectParams) error {
+	localParams, ok := params.(*LocalObjectParams)
+	if !ok {
+		return errors.New("params is not of type *LocalObjectParams")
+	}
+
+	err := l.readFile(ctx, out, localParams.ObjectName)
+	if err != nil {
+		return fmt.Errorf("read from local storage: %w", err)
+	}
+
+	return nil
+}
+
+func (l *LocalStorage) readFile(ctx context.Context, out io.Writer, objectName string) error {
+	source, err := l.objectPath(objectName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(source)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", objectName, ErrorObjectNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(out, &contextReader{ctx: ctx, reader: file})
+	if err != nil {
+		return fmt.Errorf("copy content: %w", err)
+	}
+
+	return nil
+}
+
+func (l *LocalStorage) List(ctx context.Context, params ListParams) ([]Object, error) {
+	localParams, ok := params.(*LocalListParams)
+	if !ok {
+		return nil, errors.New("params is not of type *LocalListParams")
+	}
+
+	objects, err := l.listFiles(ctx, localParams.Prefix, localParams.WithMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("list local storage: %w", err)
+	}
+
+	return objects, nil
+}
+
+func (l *LocalStorage) listFiles(ctx context.Context, prefix string, withMetadata bool) ([]Object, error) {
+	var objects []Object
+
+	err := filepath.WalkDir(l.directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if entry.IsDir() || isLocalTempFile(entry.Name()) || isLocalChecksumFile(entry.Name()) {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(l.directory, path)
+		if err != nil {
+			return err
+		}
+
+		objectName := filepath.ToSlash(relativePath)
+		if !strings.HasPrefix(objectName, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		object := Object{
+			Name:         objectName,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		}
+
+		if withMetadata {
+			object.Metadata, err = l.readMetadata(path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", objectName, err)
+			}
+		}
+
+		objects = append(objects, object)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (l *LocalStorage) Delete(_ context.Context, params ObjectParams) error {
+	localParams, ok := params.(*LocalObjectParams)
+	if !ok {
+		return errors.New("params is not of type *LocalObjectParams")
+	}
+
+	objectPath, err := l.objectPath(localParams.ObjectName)
+	if err != nil {
+		return fmt.Errorf("delete from local storage: %w", err)
+	}
+
+	err = os.Remove(objectPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete from local storage: %s: %w", localParams.ObjectName, ErrorObjectNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("delete from local storage: %w", err)
+	}
+
+	err = l.removeChecksumFile(localParams.ObjectName)
+	if err != nil {
+		return fmt.Errorf("delete from local storage: %w", err)
+	}
+
+	return nil
+}
+
+func (l *LocalStorage) Stat(_ context.Context, params ObjectParams) (Object, error) {
+	localParams, ok := params.(*LocalObjectParams)
+	if !ok {
+		return Object{}, errors.New("params is not of type *LocalObjectParams")
+	}
+
+	objectPath, err := l.objectPath(localParams.ObjectName)
+	if err != nil {
+		return Object{}, fmt.Errorf("stat in local storage: %w", err)
+	}
+
+	info, err := os.Stat(objectPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Object{}, fmt.Errorf("stat in local storage: %s: %w", localParams.ObjectName, ErrorObjectNotFound)
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("stat in local storage: %w", err)
+	}
+
+	metadata, err := l.readMetadata(objectPath)
+	if err != nil {
+		return Object{}, fmt.Errorf("stat in local storage: %w", err)
+	}
+
+	return Object{
+		Name:         localParams.ObjectName,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+		Metadata:     metadata,
+	}, nil
+}
+
+// isLocalTempFile reports whether the file is an unfinished write.
+func isLocalTempFile(name string) bool {
+	return strings.HasPrefix(name, localTempFilePrefix) && strings.HasSuffix(name, localTempFileSuffix)
+}
+
+// isLocalChecksumFile reports whether the file holds the SHA-256 of an object.
+func isLocalChecksumFile(name string) bool {
+	return strings.HasSuffix(name, localChecksumFileSuffix)
+}
+
+// objectPath returns the path of the object inside the storage directory.
+func (l *LocalStorage) objectPath(objectName string) (string, error) {
+	name := filepath.FromSlash(objectName)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%s: %w", objectName, ErrorUnsafeObjectName)
+	}
+
+	return filepath.Join(l.directory, name), nil
+}
+
+// contextReader stops reading as soon as the context is done.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	err := c.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.reader.Read(p)
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorageChecksum(t *testing.T) {
+	directory := t.TempDir()
+	localStorage := NewLocalStorage(&LocalStorageConfig{Directory: directory})
+	ctx := context.Background()
+
+	err := localStorage.Authenticate(ctx)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	content := "backup content"
+	sum := sha256.Sum256([]byte(content))
+
+	checksum := NewChecksum(strings.NewReader(content))
+	params := &LocalWriteParams{ObjectName: "daily/backup.tar"}
+	params.SetChecksum(checksum)
+
+	err = localStorage.Write(ctx, checksum, params)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	checksumFile, err := os.ReadFile(filepath.Join(directory, "daily", "backup.tar"+localChecksumFileSuffix))
+	if err != nil {
+		t.Fatalf("read checksum file: %v", err)
+	}
+
+	if want := hex.EncodeToString(sum[:]) + "  backup.tar\n"; string(checksumFile) != want {
+		t.Errorf("checksum file = %q, want %q", checksumFile, want)
+	}
+
+	object, err := localStorage.Stat(ctx, &LocalObjectParams{ObjectName: "daily/backup.tar"})
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	if object.Metadata[MetadataSha256] != hex.EncodeToString(sum[:]) {
+		t.Errorf("stat metadata = %v, want %s of the content", object.Metadata, MetadataSha256)
+	}
+
+	objects, err := localStorage.List(ctx, &LocalListParams{WithMetadata: true})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	if len(objects) != 1 || objects[0].Name != "daily/backup.tar" {
+		t.Fatalf("list = %v, want only daily/backup.tar", objects)
+	}
+
+	if objects[0].Metadata[MetadataSha256] != hex.EncodeToString(sum[:]) {
+		t.Errorf("list metadata = %v, want %s of the content", objects[0].Metadata, MetadataSha256)
+	}
+
+	// An object written without a checksum does not keep the checksum of the replaced object
+	err = localStorage.Write(ctx, strings.NewReader("other content"), &LocalWriteParams{ObjectName: "daily/backup.tar"})
+	if err != nil {
+		t.Fatalf("write without checksum: %v", err)
+	}
+
+	object, err = localStorage.Stat(ctx, &LocalObjectParams{ObjectName: "daily/backup.tar"})
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	if object.Metadata != nil {
+		t.Errorf("metadata of object without checksum = %v, want none", object.Metadata)
+	}
+
+	// Content in memory, like chunks and indexes, gets no checksum file
+	contentChecksum := NewContentChecksum([]byte("chunk"))
+	chunkParams := &LocalWriteParams{ObjectName: "chunks/ab/chunk"}
+	chunkParams.SetChecksum(contentChecksum)
+
+	err = localStorage.Write(ctx, contentChecksum, chunkParams)
+	if err != nil {
+		t.Fatalf("write content in memory: %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(directory, "chunks", "ab", "chunk"+localChecksumFileSuffix))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("checksum file of content in memory: %v, want %v", err, fs.ErrNotExist)
+	}
+
+	checksum = NewChecksum(strings.NewReader(content))
+	params.SetChecksum(checksum)
+
+	err = localStorage.Write(ctx, checksum, params)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	err = localStorage.Delete(ctx, &LocalObjectParams{ObjectName: "daily/backup.tar"})
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(directory, "daily"))
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("directory after delete has %d files, want none", len(entries))
+	}
+
+	err = localStorage.Read(ctx, io.Discard, &LocalObjectParams{ObjectName: "daily/backup.tar"})
+	if !errors.Is(err, ErrorObjectNotFound) {
+		t.Errorf("read of deleted object = %v, want %v", err, ErrorObjectNotFound)
+	}
+}
@@ -0,0 +1,27 @@
+package storage
+
+// Keys of metadata, which capyback attaches to backups, so they are self-describing.
+// Storages lower-case metadata keys, so the keys are lower-case too.
+const (
+	MetadataHost       = "capyback-host"
+	MetadataResources  = "capyback-resources"
+	MetadataFormat     = "capyback-format"
+	MetadataEncryption = "capyback-encryption"
+	MetadataVersion    = "capyback-version"
+	MetadataSha256     = "capyback-sha256"
+)
+
+// mergeMetadata copies the metadata into the destination, keys of the metadata replace existing keys.
+func mergeMetadata(destination *map[string]string, metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+
+	if *destination == nil {
+		*destination = make(map[string]string, len(metadata))
+	}
+
+	for key, value := range metadata {
+		(*destination)[key] = value
+	}
+}
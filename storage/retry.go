@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/minio/minio-go/v7"
+	"github.com/ncw/swift/v2"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = time.Second
+	defaultRetryMaxBackoff     = 30 * time.Second
+	defaultRetryMultiplier     = 2
+	defaultRetryJitter         = 0.2
+)
+
+// ErrorContentNotRewindable is an error when a failed write can not be retried,
+// because the content was partially consumed and can not be read again.
+var ErrorContentNotRewindable = errors.New("content was consumed and can not be rewound, use the spool pipe to retry writes")
+
+// RetryConfig describes how failed storage operations are retried with exponential backoff.
+// Zero values are replaced with defaults, set MaxAttempts to 1 to disable retries.
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max-attempts,omitempty"`
+	InitialBackoff time.Duration `yaml:"initial-backoff,omitempty"`
+	MaxBackoff     time.Duration `yaml:"max-backoff,omitempty"`
+	Multiplier     float64       `yaml:"multiplier,omitempty"`
+	// Jitter is a fraction of the backoff, by which it is randomly changed, from 0 to 1.
+	Jitter float64 `yaml:"jitter,omitempty"`
+}
+
+func (r RetryConfig) withDefaults() RetryConfig {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = defaultRetryMaxAttempts
+	}
+
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = defaultRetryInitialBackoff
+	}
+
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = defaultRetryMaxBackoff
+	}
+
+	if r.Multiplier < 1 {
+		r.Multiplier = defaultRetryMultiplier
+	}
+
+	if r.Jitter <= 0 {
+		r.Jitter = defaultRetryJitter
+	}
+
+	r.Jitter = math.Min(r.Jitter, 1)
+
+	return r
+}
+
+// backoff returns the delay before the next attempt after the failed attempt, attempts are numbered from 1.
+func (r RetryConfig) backoff(attempt int) time.Duration {
+	delay := float64(r.InitialBackoff) * math.Pow(r.Multiplier, float64(attempt-1))
+	delay = math.Min(delay, float64(r.MaxBackoff))
+	delay += delay * r.Jitter * (2*rand.Float64() - 1)
+
+	return time.Duration(delay)
+}
+
+// rewinder is implemented by content which can be read again from the start, see pipe.Rewinder.
+type rewinder interface {
+	Rewind() error
+}
+
+// RewindableReader is a reader of a byte slice, which a retried write reads again from the start.
+type RewindableReader struct {
+	*bytes.Reader
+}
+
+// NewRewindableReader returns a RewindableReader of the content.
+func NewRewindableReader(content []byte) *RewindableReader {
+	return &RewindableReader{Reader: bytes.NewReader(content)}
+}
+
+func (r *RewindableReader) Rewind() error {
+	_, err := r.Seek(0, io.SeekStart)
+	return err
+}
+
+// RetryStorage is a Storager, which retries failed operations of the wrapped storage.
+// Writes are retried only if the content was not consumed or can be rewound,
+// reads are retried only if nothing was written to the output.
+type RetryStorage struct {
+	storage Storager
+	config  RetryConfig
+}
+
+// NewRetryStorage wraps the storage with retries.
+func NewRetryStorage(storage Storager, config RetryConfig) *RetryStorage {
+	return &RetryStorage{storage: storage, config: config.withDefaults()}
+}
+
+func (r *RetryStorage) Authenticate(ctx context.Context) error {
+	err := r.retry(ctx, "authenticate", func() error {
+		return r.storage.Authenticate(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorAuthentication, err)
+	}
+
+	return nil
+}
+
+func (r *RetryStorage) Write(ctx context.Context, content io.Reader, params WriteParams) error {
+	contentRewinder, rewindable := content.(rewinder)
+	consumed := false
+	contentFailed := false
+
+	err := r.retry(ctx, "write", func() error {
+		if consumed {
+			err := contentRewinder.Rewind()
+			if err != nil {
+				return permanent(fmt.Errorf("rewind content: %w", err))
+			}
+		}
+
+		reader := &countingReader{reader: content}
+
+		err := r.storage.Write(ctx, reader, params)
+		consumed = consumed || reader.n > 0
+
+		switch {
+		case err == nil:
+			return nil
+		case reader.err != nil && !errors.Is(reader.err, io.EOF):
+			// The content itself failed, e.g. the archiver, retrying will not help.
+			contentFailed = true
+			return permanent(err)
+		case consumed && !rewindable && isRetryable(err):
+			return permanent(errors.Join(err, ErrorContentNotRewindable))
+		}
+
+		return err
+	})
+	if err != nil && !contentFailed {
+		return fmt.Errorf("%w: %w", ErrorUpload, err)
+	}
+
+	return err
+}
+
+func (r *RetryStorage) Read(ctx context.Context, out io.Writer, params ObjectParams) error {
+	writer := &countingWriter{writer: out}
+
+	return r.retry(ctx, "read", func() error {
+		err := r.storage.Read(ctx, writer, params)
+		if err != nil && writer.n > 0 {
+			return permanent(err)
+		}
+
+		return err
+	})
+}
+
+func (r *RetryStorage) List(ctx context.Context, params ListParams) ([]Object, error) {
+	var objects []Object
+
+	err := r.retry(ctx, "list", func() error {
+		var err error
+		objects, err = r.storage.List(ctx, params)
+
+		return err
+	})
+
+	return objects, err
+}
+
+func (r *RetryStorage) Delete(ctx context.Context, params ObjectParams) error {
+	return r.retry(ctx, "delete", func() error {
+		return r.storage.Delete(ctx, params)
+	})
+}
+
+func (r *RetryStorage) Stat(ctx context.Context, params ObjectParams) (Object, error) {
+	var object Object
+
+	err := r.retry(ctx, "stat", func() error {
+		var err error
+		object, err = r.storage.Stat(ctx, params)
+
+		return err
+	})
+
+	return object, err
+}
+
+// retry calls the operation until it succeeds, fails with a permanent or not retryable error,
+// the attempts are exhausted or the context is done.
+func (r *RetryStorage) retry(ctx context.Context, operation string, do func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := do()
+		if err == nil {
+			return nil
+		}
+
+		var permanentErr *permanentError
+		if errors.As(err, &permanentErr) {
+			return permanentErr.err
+		}
+
+		if attempt >= r.config.MaxAttempts || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+
+		delay := r.config.backoff(attempt)
+		log.Warn(
+			"Storage operation failed, retrying",
+			"operation", operation,
+			"attempt", attempt,
+			"max-attempts", r.config.MaxAttempts,
+			"delay", delay.Round(time.Millisecond),
+			"err", err,
+		)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// permanentError marks an error, which must not be retried regardless of its cause.
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string {
+	return p.err.Error()
+}
+
+func (p *permanentError) Unwrap() error {
+	return p.err
+}
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// isRetryable reports whether the error is transient: a network failure,
+// a timeout, throttling or a server error of the storage.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var swiftErr *swift.Error
+	if errors.As(err, &swiftErr) {
+		return isRetryableStatus(swiftErr.StatusCode) || swiftErr == swift.ObjectCorrupted || swiftErr == swift.RateLimit
+	}
+
+	var s3Err minio.ErrorResponse
+	if errors.As(err, &s3Err) {
+		return isRetryableStatus(s3Err.StatusCode) || s3Err.Code == "SlowDown" || s3Err.Code == "RequestTimeout"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode >= http.StatusInternalServerError
+}
+
+// countingReader counts bytes read from the reader and keeps its last error.
+type countingReader struct {
+	reader io.Reader
+	n      int64
+	err    error
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.reader.Read(p)
+	c.n += int64(n)
+	if err != nil {
+		c.err = err
+	}
+
+	return n, err
+}
+
+// countingWriter counts bytes written to the writer.
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.writer.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
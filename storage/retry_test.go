@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/ncw/swift/v2"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "swift server error", err: &swift.Error{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "swift rate limit", err: swift.RateLimit, want: true},
+		{name: "swift not found", err: swift.ObjectNotFound, want: false},
+		{name: "swift unauthorized", err: swift.AuthorizationFailed, want: false},
+		{name: "s3 slow down", err: minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "s3 request timeout", err: minio.ErrorResponse{Code: "RequestTimeout", StatusCode: http.StatusBadRequest}, want: true},
+		{name: "s3 too many requests", err: minio.ErrorResponse{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "s3 access denied", err: minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}, want: false},
+		{name: "network error", err: &net.OpError{Op: "dial", Err: errors.New("no route to host")}, want: true},
+		{name: "connection reset", err: fmt.Errorf("write: %w", syscall.ECONNRESET), want: true},
+		{name: "connection refused", err: syscall.ECONNREFUSED, want: true},
+		{name: "broken pipe", err: syscall.EPIPE, want: true},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "deadline", err: fmt.Errorf("dial: %w", context.DeadlineExceeded), want: false},
+		{name: "plain error", err: errors.New("params is not of type"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryConfigBackoff(t *testing.T) {
+	config := RetryConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2, Jitter: 0.1}.withDefaults()
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 5 * time.Second},
+		{attempt: 10, want: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempt), func(t *testing.T) {
+			got := config.backoff(tt.attempt)
+			jitter := time.Duration(float64(tt.want) * config.Jitter)
+
+			if got < tt.want-jitter || got > tt.want+jitter {
+				t.Errorf("backoff(%d) = %s, want %s ± %s", tt.attempt, got, tt.want, jitter)
+			}
+		})
+	}
+}
+
+// flakyStorage fails operations with the errors one by one, then succeeds.
+// A failed write reads a part of the content first, like an interrupted upload, a successful write reads all of it.
+type flakyStorage struct {
+	LocalStorage
+
+	errs    []error
+	written []byte
+	calls   int
+}
+
+func (f *flakyStorage) next() error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+
+	return err
+}
+
+func (f *flakyStorage) Authenticate(_ context.Context) error {
+	return f.next()
+}
+
+func (f *flakyStorage) Write(_ context.Context, content io.Reader, _ WriteParams) error {
+	err := f.next()
+	if err != nil {
+		_, _ = content.Read(make([]byte, 1))
+		return err
+	}
+
+	f.written, err = io.ReadAll(content)
+
+	return err
+}
+
+func (f *flakyStorage) Read(_ context.Context, out io.Writer, _ ObjectParams) error {
+	err := f.next()
+	if err != nil && f.calls > 1 {
+		// The first failure happens before the content, the next ones after a part of it
+		_, _ = out.Write([]byte("partial"))
+	}
+
+	return err
+}
+
+// failingContent fails after the first byte, like a failed archiver.
+type failingContent struct {
+	read bool
+}
+
+func (f *failingContent) Read(p []byte) (int, error) {
+	if f.read {
+		return 0, errors.New("archive failed")
+	}
+
+	f.read = true
+
+	return copy(p, "x"), nil
+}
+
+var testRetryConfig = RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestRetryStorageWrite(t *testing.T) {
+	transient := &swift.Error{StatusCode: http.StatusBadGateway, Text: "Bad Gateway"}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		content   func() io.Reader
+		wantCalls int
+		wantErr   []error
+		notErr    error
+	}{
+		{
+			name:      "rewound after transient errors",
+			errs:      []error{transient, transient},
+			content:   func() io.Reader { return NewRewindableReader([]byte("backup")) },
+			wantCalls: 3,
+		},
+		{
+			name:      "attempts are exhausted",
+			errs:      []error{transient, transient, transient},
+			content:   func() io.Reader { return NewRewindableReader([]byte("backup")) },
+			wantCalls: 3,
+			wantErr:   []error{ErrorUpload, transient},
+		},
+		{
+			name:      "not retryable error",
+			errs:      []error{swift.AuthorizationFailed},
+			content:   func() io.Reader { return NewRewindableReader([]byte("backup")) },
+			wantCalls: 1,
+			wantErr:   []error{ErrorUpload, swift.AuthorizationFailed},
+		},
+		{
+			name:      "consumed content without rewind",
+			errs:      []error{transient},
+			content:   func() io.Reader { return bytes.NewBufferString("backup") },
+			wantCalls: 1,
+			wantErr:   []error{ErrorUpload, ErrorContentNotRewindable},
+		},
+		{
+			name:      "failed content is not an upload error",
+			content:   func() io.Reader { return &failingContent{} },
+			wantCalls: 1,
+			notErr:    ErrorUpload,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &flakyStorage{errs: tt.errs}
+			retryStorage := NewRetryStorage(flaky, testRetryConfig)
+
+			err := retryStorage.Write(context.Background(), tt.content(), &LocalWriteParams{})
+
+			if flaky.calls != tt.wantCalls {
+				t.Errorf("write was called %d times, want %d", flaky.calls, tt.wantCalls)
+			}
+
+			for _, wantErr := range tt.wantErr {
+				if !errors.Is(err, wantErr) {
+					t.Errorf("error = %v, want %v", err, wantErr)
+				}
+			}
+
+			if tt.wantErr == nil && tt.notErr == nil {
+				if err != nil {
+					t.Fatalf("error = %v", err)
+				}
+
+				if string(flaky.written) != "backup" {
+					t.Errorf("written %q, want %q", flaky.written, "backup")
+				}
+			}
+
+			if tt.notErr != nil && (err == nil || errors.Is(err, tt.notErr)) {
+				t.Errorf("error = %v, want an error, which is not %v", err, tt.notErr)
+			}
+		})
+	}
+}
+
+func TestRetryStorageRead(t *testing.T) {
+	transient := &swift.Error{StatusCode: http.StatusServiceUnavailable, Text: "Service Unavailable"}
+
+	// The first failure happens before any content is written and is retried, the second one is not
+	flaky := &flakyStorage{errs: []error{transient, transient, transient}}
+	retryStorage := NewRetryStorage(flaky, testRetryConfig)
+
+	err := retryStorage.Read(context.Background(), io.Discard, &LocalObjectParams{})
+	if !errors.Is(err, transient) {
+		t.Errorf("error = %v, want %v", err, transient)
+	}
+
+	if flaky.calls != 2 {
+		t.Errorf("read was called %d times, want 2", flaky.calls)
+	}
+}
+
+func TestRetryStorageAuthenticate(t *testing.T) {
+	flaky := &flakyStorage{errs: []error{swift.AuthorizationFailed}}
+
+	err := NewRetryStorage(flaky, testRetryConfig).Authenticate(context.Background())
+	if !errors.Is(err, ErrorAuthentication) || !errors.Is(err, swift.AuthorizationFailed) {
+		t.Errorf("error = %v, want %v and %v", err, ErrorAuthentication, swift.AuthorizationFailed)
+	}
+}
@@ -0,0 +1,464 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/FirinKinuo/capyback/bytesize"
+
+	"github.com/charmbracelet/log"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	envS3AccessKeyId     = "AWS_ACCESS_KEY_ID"
+	envS3SecretAccessKey = "AWS_SECRET_ACCESS_KEY"
+	envS3SessionToken    = "AWS_SESSION_TOKEN"
+	envS3Region          = "AWS_REGION"
+	envS3Endpoint        = "S3_STORAGE_ENDPOINT"
+	envS3Bucket          = "S3_STORAGE_BUCKET"
+)
+
+// unknownObjectSize tells the S3 client to stream the content with multipart upload.
+const unknownObjectSize = -1
+
+// maxS3CopySize is the maximum size of an object copied by a single request.
+// Checksums of larger streamed objects are not added to their metadata.
+const maxS3CopySize = 5 * bytesize.GiB
+
+// defaultS3PartSize is a size of multipart upload part, when it is not set.
+// Every part is buffered in memory, the size limits objects to 625GiB.
+const defaultS3PartSize = 64 * bytesize.MiB
+
+type S3StorageConfig struct {
+	// Endpoint is an address of S3 API, with or without scheme. Https is used when scheme is omitted.
+	Endpoint        string `yaml:"endpoint,omitempty"`
+	Region          string `yaml:"region,omitempty"`
+	AccessKeyID     string `yaml:"access-key-id,omitempty"`
+	SecretAccessKey string `yaml:"secret-access-key,omitempty"`
+	SessionToken    string `yaml:"session-token,omitempty"`
+	// PathStyle enables path-style bucket addressing required by most MinIO and Ceph RGW setups.
+	PathStyle bool `yaml:"path-style,omitempty"`
+	// Transport replaces the default HTTP transport, e.g. to trust the certificate of a test server.
+	Transport http.RoundTripper `yaml:"-"`
+}
+
+// ReadFromEnviron overrides the config with the set environment variables.
+func (s *S3StorageConfig) ReadFromEnviron() error {
+	setFromEnviron(&s.Endpoint, envS3Endpoint)
+	setFromEnviron(&s.Region, envS3Region)
+	setFromEnviron(&s.AccessKeyID, envS3AccessKeyId)
+	setFromEnviron(&s.SecretAccessKey, envS3SecretAccessKey)
+	setFromEnviron(&s.SessionToken, envS3SessionToken)
+
+	return nil
+}
+
+// s3Environ holds s3 storage params set by environment variables.
+type s3Environ struct {
+	S3StorageConfig `yaml:",inline"`
+	Bucket          string `yaml:"bucket,omitempty"`
+}
+
+func (s *s3Environ) ReadFromEnviron() error {
+	setFromEnviron(&s.Bucket, envS3Bucket)
+
+	return s.S3StorageConfig.ReadFromEnviron()
+}
+
+// s3NoSuchKeyCode is an error code of S3 for a missing object.
+const s3NoSuchKeyCode = "NoSuchKey"
+
+// Headers, which are sent with user metadata, when the metadata of an object is replaced.
+const (
+	s3ContentTypeHeader  = "Content-Type"
+	s3StorageClassHeader = "X-Amz-Storage-Class"
+)
+
+type S3WriteParams struct {
+	Bucket       string `yaml:"bucket"`
+	StorageClass string `yaml:"storage-class"`
+	// PartSize is a size of multipart upload part, it limits the maximum object size to 10000 parts.
+	// Content smaller than a part is uploaded in one request, when its size is known.
+	PartSize    bytesize.Size `yaml:"part-size"`
+	ObjectName  string        `yaml:"-"`
+	ContentType string        `yaml:"-"`
+	// Metadata is stored as user metadata of the object.
+	Metadata map[string]string `yaml:"metadata"`
+
+	checksum *Checksum
+	size     int64
+}
+
+func (s *S3WriteParams) Name() string {
+	return s.ObjectName
+}
+
+func (s *S3WriteParams) SetName(name string) {
+	s.ObjectName = name
+}
+
+func (s *S3WriteParams) SetMetadata(metadata map[string]string) {
+	mergeMetadata(&s.Metadata, metadata)
+}
+
+// SetChecksum sets the checksum, which is compared with ETag of the object. Its SHA-256 is stored in metadata,
+// it is sent with the object when it is known before the upload.
+func (s *S3WriteParams) SetChecksum(checksum *Checksum) {
+	s.checksum = checksum
+}
+
+// userMetadata returns a copy of the metadata, the client adds its own keys to metadata of multipart upload.
+func (s *S3WriteParams) userMetadata() map[string]string {
+	metadata := make(map[string]string, len(s.Metadata)+1)
+	mergeMetadata(&metadata, s.Metadata)
+
+	return metadata
+}
+
+func (s *S3WriteParams) SetSize(size int64) {
+	s.size = size
+}
+
+// objectSize returns the size of the content for the client, unknownObjectSize if it is not known.
+func (s *S3WriteParams) objectSize() int64 {
+	if s.size <= 0 {
+		return unknownObjectSize
+	}
+
+	return s.size
+}
+
+// partSize returns the size of multipart upload part, defaultS3PartSize if it is not set.
+func (s *S3WriteParams) partSize() uint64 {
+	if s.PartSize <= 0 {
+		return uint64(defaultS3PartSize)
+	}
+
+	return uint64(s.PartSize)
+}
+
+type S3ObjectParams struct {
+	Bucket     string `yaml:"bucket"`
+	ObjectName string `yaml:"-"`
+}
+
+func (s *S3ObjectParams) Name() string {
+	return s.ObjectName
+}
+
+func (s *S3ObjectParams) SetName(name string) {
+	s.ObjectName = name
+}
+
+type S3ListParams struct {
+	Bucket       string `yaml:"bucket"`
+	Prefix       string `yaml:"-"`
+	WithMetadata bool   `yaml:"-"`
+}
+
+func (s *S3ListParams) SetPrefix(prefix string) {
+	s.Prefix = prefix
+}
+
+func (s *S3ListParams) SetWithMetadata(withMetadata bool) {
+	s.WithMetadata = withMetadata
+}
+
+// S3Storage stores backups in S3-compatible object storage.
+type S3Storage struct {
+	config *S3StorageConfig
+	client *minio.Client
+}
+
+func NewS3Storage(config *S3StorageConfig) *S3Storage {
+	return &S3Storage{config: config}
+}
+
+// Authenticate prepares the client with configured credentials.
+// S3 signs every request separately, so the credentials are checked by the server on the first request.
+func (s *S3Storage) Authenticate(_ context.Context) error {
+	endpoint, secure, err := s.parseEndpoint()
+	if err != nil {
+		return fmt.Errorf("parse endpoint: %w", err)
+	}
+
+	bucketLookup := minio.BucketLookupAuto
+	if s.config.PathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+
+	s.client, err = minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(s.config.AccessKeyID, s.config.SecretAccessKey, s.config.SessionToken),
+		Secure:       secure,
+		Region:       s.config.Region,
+		BucketLookup: bucketLookup,
+		Transport:    s.config.Transport,
+	})
+	if err != nil {
+		return fmt.Errorf("create s3 client: %w", err)
+	}
+
+	return nil
+}
+
+// parseEndpoint splits the configured endpoint into host and TLS usage.
+func (s *S3Storage) parseEndpoint() (host string, secure bool, err error) {
+	if s.config.Endpoint == "" {
+		return "", false, errors.New("endpoint is not specified")
+	}
+
+	if !strings.Contains(s.config.Endpoint, "://") {
+		return s.config.Endpoint, true, nil
+	}
+
+	endpointUrl, err := url.Parse(s.config.Endpoint)
+	if err != nil {
+		return "", false, err
+	}
+
+	switch endpointUrl.Scheme {
+	case "https":
+		return endpointUrl.Host, true, nil
+	case "http":
+		return endpointUrl.Host, false, nil
+	default:
+		return "", false, fmt.Errorf("unsupported scheme %q", endpointUrl.Scheme)
+	}
+}
+
+func (s *S3Storage) Write(ctx context.Context, content io.Reader, params WriteParams) error {
+	s3Params, ok := params.(*S3WriteParams)
+	if !ok {
+		return errors.New("params is not of type *S3WriteParams")
+	}
+
+	err := s.putObject(ctx, content, s3Params)
+	if err != nil {
+		return fmt.Errorf("write to s3 storage: %w", err)
+	}
+
+	return nil
+}
+
+// putObject streams content with multipart upload, unless the size of the content is known in advance.
+// The SHA-256 of the checksum is stored in metadata.
+func (s *S3Storage) putObject(ctx context.Context, content io.Reader, s3Params *S3WriteParams) error {
+	checksum := s3Params.checksum
+	if checksum == nil {
+		checksum = NewChecksum(content)
+		content = checksum
+	}
+
+	checksum.splitParts(int64(s3Params.partSize()))
+
+	metadata := s3Params.userMetadata()
+	if checksum.knownSHA256() != "" {
+		metadata[MetadataSha256] = checksum.knownSHA256()
+	}
+
+	uploadInfo, err := s.client.PutObject(
+		ctx,
+		s3Params.Bucket,
+		s3Params.ObjectName,
+		content,
+		s3Params.objectSize(),
+		minio.PutObjectOptions{
+			ContentType:  s3Params.ContentType,
+			StorageClass: s3Params.StorageClass,
+			PartSize:     s3Params.partSize(),
+			UserMetadata: metadata,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = checksum.VerifyETag(uploadInfo.ETag)
+	if err != nil {
+		return err
+	}
+
+	// The SHA-256 of a streamed backup is known only after the upload
+	if s3Params.checksum != nil && checksum.knownSHA256() == "" {
+		s.addChecksum(ctx, s3Params, checksum, uploadInfo.ETag)
+	}
+
+	return nil
+}
+
+// addChecksum adds the SHA-256 to metadata of the uploaded object by a copy of the object onto itself.
+// The object is already uploaded and verified, so a failed copy is only logged, the backup is verified without it.
+func (s *S3Storage) addChecksum(ctx context.Context, s3Params *S3WriteParams, checksum *Checksum, etag string) {
+	if checksum.Size() > int64(maxS3CopySize) {
+		log.Warn("Object is too large to add its checksum to metadata", "name", s3Params.ObjectName)
+		return
+	}
+
+	// A copy replaces all metadata, so the content type and the storage class are sent again
+	metadata := s3Params.userMetadata()
+	metadata[MetadataSha256] = checksum.SHA256()
+	if s3Params.ContentType != "" {
+		metadata[s3ContentTypeHeader] = s3Params.ContentType
+	}
+	if s3Params.StorageClass != "" {
+		metadata[s3StorageClassHeader] = s3Params.StorageClass
+	}
+
+	_, err := s.client.CopyObject(
+		ctx,
+		minio.CopyDestOptions{
+			Bucket:          s3Params.Bucket,
+			Object:          s3Params.ObjectName,
+			UserMetadata:    metadata,
+			ReplaceMetadata: true,
+		},
+		minio.CopySrcOptions{Bucket: s3Params.Bucket, Object: s3Params.ObjectName, MatchETag: etag},
+	)
+	if err != nil {
+		log.Warn("Failed to add checksum to metadata", "name", s3Params.ObjectName, "err", err)
+	}
+}
+
+func (s *S3Storage) Read(ctx context.Context, out io.Writer, params ObjectParams) error {
+	s3Params, ok := params.(*S3ObjectParams)
+	if !ok {
+		return errors.New("params is not of type *S3ObjectParams")
+	}
+
+	err := s.getObject(ctx, out, s3Params)
+	if err != nil {
+		return fmt.Errorf("read from s3 storage: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) getObject(ctx context.Context, out io.Writer, s3Params *S3ObjectParams) error {
+	object, err := s.client.GetObject(ctx, s3Params.Bucket, s3Params.ObjectName, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	// The object is requested on the first read, so a missing object is reported by the copy
+	_, err = io.Copy(out, object)
+	if minio.ToErrorResponse(err).Code == s3NoSuchKeyCode {
+		return fmt.Errorf("%s: %w", s3Params.ObjectName, ErrorObjectNotFound)
+	}
+
+	return err
+}
+
+func (s *S3Storage) List(ctx context.Context, params ListParams) ([]Object, error) {
+	s3Params, ok := params.(*S3ListParams)
+	if !ok {
+		return nil, errors.New("params is not of type *S3ListParams")
+	}
+
+	objects, err := s.listObjects(ctx, s3Params)
+	if err != nil {
+		return nil, fmt.Errorf("list s3 storage: %w", err)
+	}
+
+	return objects, nil
+}
+
+func (s *S3Storage) listObjects(ctx context.Context, s3Params *S3ListParams) ([]Object, error) {
+	var objects []Object
+
+	listOptions := minio.ListObjectsOptions{Prefix: s3Params.Prefix, Recursive: true}
+
+	for objectInfo := range s.client.ListObjects(ctx, s3Params.Bucket, listOptions) {
+		if objectInfo.Err != nil {
+			return nil, objectInfo.Err
+		}
+
+		object := Object{
+			Name:         objectInfo.Key,
+			Size:         objectInfo.Size,
+			LastModified: objectInfo.LastModified,
+			Hash:         objectInfo.ETag,
+		}
+
+		if s3Params.WithMetadata {
+			// Listing returns user metadata only on MinIO, so each object has to be requested separately
+			statInfo, err := s.client.StatObject(ctx, s3Params.Bucket, objectInfo.Key, minio.StatObjectOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("stat object %s: %w", objectInfo.Key, err)
+			}
+
+			object.Metadata = lowerMetadata(statInfo.UserMetadata)
+		}
+
+		objects = append(objects, object)
+	}
+
+	return objects, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, params ObjectParams) error {
+	s3Params, ok := params.(*S3ObjectParams)
+	if !ok {
+		return errors.New("params is not of type *S3ObjectParams")
+	}
+
+	// S3 deletes missing objects successfully, so the object is checked first like in other storages
+	_, err := s.client.StatObject(ctx, s3Params.Bucket, s3Params.ObjectName, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == s3NoSuchKeyCode {
+		return fmt.Errorf("delete from s3 storage: %s: %w", s3Params.ObjectName, ErrorObjectNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("delete from s3 storage: %w", err)
+	}
+
+	err = s.client.RemoveObject(ctx, s3Params.Bucket, s3Params.ObjectName, minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("delete from s3 storage: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, params ObjectParams) (Object, error) {
+	s3Params, ok := params.(*S3ObjectParams)
+	if !ok {
+		return Object{}, errors.New("params is not of type *S3ObjectParams")
+	}
+
+	objectInfo, err := s.client.StatObject(ctx, s3Params.Bucket, s3Params.ObjectName, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == s3NoSuchKeyCode {
+		return Object{}, fmt.Errorf("stat in s3 storage: %s: %w", s3Params.ObjectName, ErrorObjectNotFound)
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("stat in s3 storage: %w", err)
+	}
+
+	return Object{
+		Name:         objectInfo.Key,
+		Size:         objectInfo.Size,
+		LastModified: objectInfo.LastModified,
+		Hash:         objectInfo.ETag,
+		Metadata:     lowerMetadata(objectInfo.UserMetadata),
+	}, nil
+}
+
+// lowerMetadata lower-cases keys of user metadata, which the client returns in canonical form of HTTP headers.
+func lowerMetadata(userMetadata map[string]string) map[string]string {
+	if userMetadata == nil {
+		return nil
+	}
+
+	metadata := make(map[string]string, len(userMetadata))
+	for key, value := range userMetadata {
+		metadata[strings.ToLower(key)] = value
+	}
+
+	return metadata
+}
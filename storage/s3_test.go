@@ -0,0 +1,463 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FirinKinuo/capyback/bytesize"
+)
+
+const testS3Bucket = "backups"
+
+// fakeS3Object is an object stored by fakeS3.
+type fakeS3Object struct {
+	content  []byte
+	etag     string
+	metadata map[string]string
+	modified time.Time
+}
+
+// fakeS3Upload is a multipart upload in progress, metadata is sent when the upload is created.
+type fakeS3Upload struct {
+	parts    map[int][]byte
+	metadata map[string]string
+}
+
+// fakeS3 is an in-process S3 server with a single bucket, it understands only requests made by S3Storage.
+// Signatures are not checked.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]*fakeS3Object
+	uploads map[string]*fakeS3Upload
+	// puts counts single request uploads, parts counts uploaded parts of multipart uploads.
+	puts   int
+	parts  []int
+	copies int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: make(map[string]*fakeS3Object),
+		uploads: make(map[string]*fakeS3Upload),
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != testS3Bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, query.Get("prefix"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.createUpload(w, r, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		f.uploadPart(w, r, query.Get("uploadId"), query.Get("partNumber"))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.completeUpload(w, key, query.Get("uploadId"))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.copy(w, r, key)
+	case r.Method == http.MethodPut:
+		f.put(w, r, key)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		f.get(w, r, key)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) put(w http.ResponseWriter, r *http.Request, key string) {
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	f.puts++
+	f.store(key, content, md5Hex(content), userMetadata(r.Header))
+	w.Header().Set("ETag", strconv.Quote(f.objects[key].etag))
+}
+
+func (f *fakeS3) copy(w http.ResponseWriter, r *http.Request, key string) {
+	copySource, err := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"))
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	source, ok := f.objects[strings.TrimPrefix(copySource, testS3Bucket+"/")]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	match := r.Header.Get("X-Amz-Copy-Source-If-Match")
+	if match != "" && strings.Trim(match, "\"") != source.etag {
+		writeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	metadata := source.metadata
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		metadata = userMetadata(r.Header)
+	}
+
+	f.copies++
+	f.store(key, source.content, source.etag, metadata)
+
+	writeS3XML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified string
+	}{ETag: strconv.Quote(source.etag), LastModified: time.Now().UTC().Format(time.RFC3339)})
+}
+
+func (f *fakeS3) store(key string, content []byte, etag string, metadata map[string]string) {
+	f.objects[key] = &fakeS3Object{content: content, etag: etag, metadata: metadata, modified: time.Now().UTC()}
+}
+
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, key string) {
+	object, ok := f.objects[key]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	for name, value := range object.metadata {
+		w.Header().Set("X-Amz-Meta-"+name, value)
+	}
+
+	w.Header().Set("ETag", strconv.Quote(object.etag))
+	w.Header().Set("Last-Modified", object.modified.Format(http.TimeFormat))
+	w.Header().Set("Content-Length", strconv.Itoa(len(object.content)))
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(object.content)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: testS3Bucket, Prefix: prefix}
+
+	for key, object := range f.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: object.modified.Format(time.RFC3339),
+			ETag:         strconv.Quote(object.etag),
+			Size:         len(object.content),
+		})
+	}
+
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+
+	writeS3XML(w, result)
+}
+
+func (f *fakeS3) createUpload(w http.ResponseWriter, r *http.Request, key string) {
+	uploadID := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+	f.uploads[uploadID] = &fakeS3Upload{parts: make(map[int][]byte), metadata: userMetadata(r.Header)}
+
+	writeS3XML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: testS3Bucket, Key: key, UploadId: uploadID})
+}
+
+func (f *fakeS3) uploadPart(w http.ResponseWriter, r *http.Request, uploadID string, partNumber string) {
+	upload, ok := f.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	number, err := strconv.Atoi(partNumber)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	upload.parts[number] = content
+	f.parts = append(f.parts, len(content))
+	w.Header().Set("ETag", strconv.Quote(md5Hex(content)))
+}
+
+func (f *fakeS3) completeUpload(w http.ResponseWriter, key string, uploadID string) {
+	upload, ok := f.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	delete(f.uploads, uploadID)
+
+	var content, sums []byte
+	for number := 1; number <= len(upload.parts); number++ {
+		content = append(content, upload.parts[number]...)
+		sum := md5.Sum(upload.parts[number])
+		sums = append(sums, sum[:]...)
+	}
+
+	etag := fmt.Sprintf("%s-%d", md5Hex(sums), len(upload.parts))
+	f.store(key, content, etag, upload.metadata)
+
+	writeS3XML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: testS3Bucket, Key: key, ETag: strconv.Quote(etag)})
+}
+
+func userMetadata(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+
+	for name := range header {
+		lowerName := strings.ToLower(name)
+		if strings.HasPrefix(lowerName, "x-amz-meta-") {
+			metadata[strings.TrimPrefix(lowerName, "x-amz-meta-")] = header.Get(name)
+		}
+	}
+
+	return metadata
+}
+
+func md5Hex(content []byte) string {
+	sum := md5.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeS3XML(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(value)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+// newTestS3Storage starts fakeS3 and returns the storage authenticated to it.
+func newTestS3Storage(t *testing.T) (*S3Storage, *fakeS3) {
+	t.Helper()
+
+	fake := newFakeS3()
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	s3Storage := NewS3Storage(&S3StorageConfig{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+		Transport:       server.Client().Transport,
+	})
+
+	err := s3Storage.Authenticate(context.Background())
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	return s3Storage, fake
+}
+
+func TestS3StorageWrite(t *testing.T) {
+	partSize := 5 * bytesize.MiB
+
+	tests := []struct {
+		name      string
+		size      int
+		knownSize bool
+		wantPuts  int
+		wantParts []int
+	}{
+		{name: "known size smaller than part", size: 1024, knownSize: true, wantPuts: 1},
+		{name: "unknown size smaller than part", size: 1024, wantParts: []int{1024}},
+		{
+			name:      "unknown size of several parts",
+			size:      int(2*partSize) + 10,
+			wantParts: []int{int(partSize), int(partSize), 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Storage, fake := newTestS3Storage(t)
+			content := bytes.Repeat([]byte("capyback"), tt.size/8+1)[:tt.size]
+
+			params := &S3WriteParams{Bucket: testS3Bucket, ObjectName: "backup.tar", PartSize: partSize}
+			if tt.knownSize {
+				params.SetSize(int64(tt.size))
+			}
+
+			checksum := NewChecksum(bytes.NewReader(content))
+			params.SetChecksum(checksum)
+
+			err := s3Storage.Write(context.Background(), checksum, params)
+			if err != nil {
+				t.Fatalf("write: %v", err)
+			}
+
+			if fake.puts != tt.wantPuts {
+				t.Errorf("puts = %d, want %d", fake.puts, tt.wantPuts)
+			}
+
+			if fmt.Sprint(fake.parts) != fmt.Sprint(tt.wantParts) {
+				t.Errorf("parts = %v, want %v", fake.parts, tt.wantParts)
+			}
+
+			// The SHA-256 of a streamed backup is added by a copy after the upload
+			if fake.copies != 1 {
+				t.Errorf("copies = %d, want 1", fake.copies)
+			}
+
+			var out bytes.Buffer
+			err = s3Storage.Read(context.Background(), &out, &S3ObjectParams{Bucket: testS3Bucket, ObjectName: "backup.tar"})
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+
+			if !bytes.Equal(out.Bytes(), content) {
+				t.Errorf("read %d bytes, want the written %d bytes", out.Len(), len(content))
+			}
+
+			object, err := s3Storage.Stat(context.Background(), &S3ObjectParams{Bucket: testS3Bucket, ObjectName: "backup.tar"})
+			if err != nil {
+				t.Fatalf("stat: %v", err)
+			}
+
+			sum := sha256.Sum256(content)
+			if object.Metadata[MetadataSha256] != hex.EncodeToString(sum[:]) {
+				t.Errorf("%s = %q, want %x", MetadataSha256, object.Metadata[MetadataSha256], sum)
+			}
+		})
+	}
+}
+
+func TestS3StorageObjects(t *testing.T) {
+	s3Storage, fake := newTestS3Storage(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"daily/a.tar", "daily/b.tar", "weekly/c.tar"} {
+		checksum := NewContentChecksum([]byte(name))
+		params := &S3WriteParams{Bucket: testS3Bucket, ObjectName: name, Metadata: map[string]string{"job": "test"}}
+		params.SetChecksum(checksum)
+		params.SetSize(int64(len(name)))
+
+		err := s3Storage.Write(ctx, checksum, params)
+		if err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	// The SHA-256 of content in memory is sent with the object
+	if fake.puts != 3 || fake.copies != 0 {
+		t.Errorf("puts = %d, copies = %d, want 3 puts and no copies", fake.puts, fake.copies)
+	}
+
+	objects, err := s3Storage.List(ctx, &S3ListParams{Bucket: testS3Bucket, Prefix: "daily/", WithMetadata: true})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	if len(objects) != 2 || objects[0].Name != "daily/a.tar" || objects[1].Name != "daily/b.tar" {
+		t.Fatalf("list = %v, want daily/a.tar and daily/b.tar", objects)
+	}
+
+	if objects[0].Metadata["job"] != "test" {
+		t.Errorf("metadata = %v, want job=test", objects[0].Metadata)
+	}
+
+	sum := sha256.Sum256([]byte("daily/a.tar"))
+	if objects[0].Metadata[MetadataSha256] != hex.EncodeToString(sum[:]) {
+		t.Errorf("metadata = %v, want %s of the content", objects[0].Metadata, MetadataSha256)
+	}
+
+	object, err := s3Storage.Stat(ctx, &S3ObjectParams{Bucket: testS3Bucket, ObjectName: "weekly/c.tar"})
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	if object.Size != int64(len("weekly/c.tar")) {
+		t.Errorf("size = %d, want %d", object.Size, len("weekly/c.tar"))
+	}
+
+	err = s3Storage.Delete(ctx, &S3ObjectParams{Bucket: testS3Bucket, ObjectName: "weekly/c.tar"})
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	_, err = s3Storage.Stat(ctx, &S3ObjectParams{Bucket: testS3Bucket, ObjectName: "weekly/c.tar"})
+	if !errors.Is(err, ErrorObjectNotFound) {
+		t.Errorf("stat of deleted object = %v, want %v", err, ErrorObjectNotFound)
+	}
+
+	err = s3Storage.Read(ctx, io.Discard, &S3ObjectParams{Bucket: testS3Bucket, ObjectName: "weekly/c.tar"})
+	if !errors.Is(err, ErrorObjectNotFound) {
+		t.Errorf("read of deleted object = %v, want %v", err, ErrorObjectNotFound)
+	}
+
+	err = s3Storage.Delete(ctx, &S3ObjectParams{Bucket: testS3Bucket, ObjectName: "weekly/c.tar"})
+	if !errors.Is(err, ErrorObjectNotFound) {
+		t.Errorf("delete of deleted object = %v, want %v", err, ErrorObjectNotFound)
+	}
+}
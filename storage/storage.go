@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"strings"
+	"time"
 )
 
 type Type string
@@ -17,6 +18,10 @@ func (t *Type) Set(s string) error {
 	switch Type(s) {
 	case SwiftStorageType:
 		*t = SwiftStorageType
+	case LocalStorageType, filesystemStorageType:
+		*t = LocalStorageType
+	case S3StorageType:
+		*t = S3StorageType
 	default:
 		return UndefinedStorageTypeErr
 	}
@@ -24,17 +29,35 @@ func (t *Type) Set(s string) error {
 	return nil
 }
 
+// UnmarshalText sets the Type from its text representation, so aliases are accepted in yaml.
+func (t *Type) UnmarshalText(text []byte) error {
+	return t.Set(string(text))
+}
+
 func (t Type) Type() string {
 	return "storage"
 }
 
 const (
 	SwiftStorageType Type = "swift"
+	LocalStorageType Type = "local"
+	S3StorageType    Type = "s3"
+
+	// filesystemStorageType is an alias of LocalStorageType
+	filesystemStorageType Type = "filesystem"
 )
 
 var (
-	AvailableStorageType    = []Type{SwiftStorageType}
+	AvailableStorageType    = []Type{SwiftStorageType, LocalStorageType, S3StorageType}
 	UndefinedStorageTypeErr = errors.New("undefined storage type")
+
+	// ErrorObjectNotFound is an error when the object does not exist in the storage.
+	ErrorObjectNotFound = errors.New("object not found")
+	// ErrorAuthentication is an error when the storage can not be authenticated after retries.
+	ErrorAuthentication = errors.New("storage authentication failed")
+	// ErrorUpload is an error when the storage failed to write the content after retries.
+	// It is not returned, when the content itself failed to be read.
+	ErrorUpload = errors.New("upload failed")
 )
 
 func StringAvailableStorages() string {
@@ -50,8 +73,44 @@ func StringAvailableStorages() string {
 type Storager interface {
 	Authenticate(ctx context.Context) error
 	Write(ctx context.Context, content io.Reader, params WriteParams) error
+	Read(ctx context.Context, out io.Writer, params ObjectParams) error
+	List(ctx context.Context, params ListParams) ([]Object, error)
+	Delete(ctx context.Context, params ObjectParams) error
+	// Stat returns the object without its content, or ErrorObjectNotFound if it does not exist.
+	Stat(ctx context.Context, params ObjectParams) (Object, error)
 }
 
 type WriteParams interface {
+	Name() string
 	SetName(name string)
+	// SetMetadata adds metadata to the object, storages without metadata ignore it.
+	SetMetadata(metadata map[string]string)
+	// SetChecksum sets the checksum of the written content, which must be read through it.
+	// Storages compare it with the uploaded object and store the SHA-256 in metadata, if they can.
+	SetChecksum(checksum *Checksum)
+	// SetSize sets the size of the content, when it is known in advance.
+	// Storages, which upload content of unknown size in parts, upload it in one request.
+	SetSize(size int64)
+}
+
+// ObjectParams addresses an already stored object.
+type ObjectParams interface {
+	Name() string
+	SetName(name string)
+}
+
+// ListParams describes which objects should be listed.
+type ListParams interface {
+	SetPrefix(prefix string)
+	// SetWithMetadata requests object metadata, which may cost an extra request per object.
+	SetWithMetadata(withMetadata bool)
+}
+
+// Object describes a stored object.
+type Object struct {
+	Name         string            `json:"name" yaml:"name"`
+	Size         int64             `json:"size" yaml:"size"`
+	LastModified time.Time         `json:"last-modified" yaml:"last-modified"`
+	Hash         string            `json:"hash,omitempty" yaml:"hash,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
@@ -7,7 +7,11 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/FirinKinuo/capyback/bytesize"
+
+	"github.com/charmbracelet/log"
 	"github.com/ncw/swift/v2"
 )
 
@@ -20,32 +24,44 @@ const (
 	envSwiftStorageAuthVersion = "SWIFT_STORAGE_AUTH_VERSION"
 	envSwiftStorageDomain      = "SWIFT_STORAGE_DOMAIN"
 	envSwiftStorageTenant      = "SWIFT_STORAGE_TENANT"
+	envSwiftStorageContainer   = "SWIFT_STORAGE_CONTAINER"
 )
 
+const swiftDeleteAtHeader = "X-Delete-At"
+
+// swiftSegmentContainerSuffix is appended to the container name to get the default container of segments.
+const swiftSegmentContainerSuffix = "_segments"
+
 const (
 	swiftMinSupportedAuthVersion = 1
 	swiftMaxSupportedAuthVersion = 3
 )
 
 type SwiftStorageConfig struct {
-	UserName    string `yaml:"user-name"`
-	ApiKey      string `yaml:"api-key"`
-	AuthUrl     string `yaml:"auth-url"`
-	Region      string `yaml:"region"`
-	UserAgent   string `yaml:"user-agent"`
-	AuthVersion int    `yaml:"auth-version"`
-	Domain      string `yaml:"domain"`
-	Tenant      string `yaml:"tenant"`
+	UserName    string `yaml:"user-name,omitempty"`
+	ApiKey      string `yaml:"api-key,omitempty"`
+	AuthUrl     string `yaml:"auth-url,omitempty"`
+	Region      string `yaml:"region,omitempty"`
+	UserAgent   string `yaml:"user-agent,omitempty"`
+	AuthVersion int    `yaml:"auth-version,omitempty"`
+	Domain      string `yaml:"domain,omitempty"`
+	Tenant      string `yaml:"tenant,omitempty"`
 }
 
+// ReadFromEnviron overrides the config with the set environment variables.
 func (s *SwiftStorageConfig) ReadFromEnviron() error {
-	s.UserName = os.Getenv(envSwiftStorageUsername)
-	s.ApiKey = os.Getenv(envSwiftStorageApiKey)
-	s.AuthUrl = os.Getenv(envSwiftStorageAuthUrl)
-	s.Region = os.Getenv(envSwiftStorageRegion)
-	s.UserAgent = os.Getenv(envSwiftStorageUserAgent)
-	s.Domain = os.Getenv(envSwiftStorageDomain)
-	s.Tenant = os.Getenv(envSwiftStorageTenant)
+	setFromEnviron(&s.UserName, envSwiftStorageUsername)
+	setFromEnviron(&s.ApiKey, envSwiftStorageApiKey)
+	setFromEnviron(&s.AuthUrl, envSwiftStorageAuthUrl)
+	setFromEnviron(&s.Region, envSwiftStorageRegion)
+	setFromEnviron(&s.UserAgent, envSwiftStorageUserAgent)
+	setFromEnviron(&s.Domain, envSwiftStorageDomain)
+	setFromEnviron(&s.Tenant, envSwiftStorageTenant)
+
+	if os.Getenv(envSwiftStorageAuthVersion) == "" {
+		return nil
+	}
+
 	authVersion, err := s.readAuthVersion()
 	if err != nil {
 		return fmt.Errorf("read auth version: %w", err)
@@ -68,17 +84,115 @@ func (s *SwiftStorageConfig) readAuthVersion() (int, error) {
 	return authVersion, nil
 }
 
+// swiftEnviron holds swift storage params set by environment variables.
+type swiftEnviron struct {
+	SwiftStorageConfig `yaml:",inline"`
+	Container          string `yaml:"container,omitempty"`
+}
+
+func (s *swiftEnviron) ReadFromEnviron() error {
+	setFromEnviron(&s.Container, envSwiftStorageContainer)
+
+	return s.SwiftStorageConfig.ReadFromEnviron()
+}
+
 type SwiftWriteParams struct {
 	Container   string `yaml:"container"`
 	ObjectName  string `yaml:"-"`
-	Hash        string `yaml:"-"`
-	ContentType string `yaml:"-"`
+	Hash        string `yaml:"hash"`
+	ContentType string `yaml:"content-type"`
+	// SegmentSize enables Static Large Object uploads, the object is uploaded in segments of this size
+	// and joined by a manifest, so it is not limited by the max object size of Swift.
+	// Content of known size up to the segment size is uploaded as a plain object.
+	// Every segment is buffered in memory before it is uploaded.
+	SegmentSize bytesize.Size `yaml:"segment-size"`
+	// SegmentContainer is a container of segments, "<container>_segments" is used when it is empty.
+	SegmentContainer string `yaml:"segment-container"`
+	// DeleteAfter makes Swift delete the object after the duration since the upload.
+	DeleteAfter time.Duration `yaml:"delete-after"`
+	// DeleteAt makes Swift delete the object at the time, the earlier time is used together with DeleteAfter.
+	DeleteAt time.Time `yaml:"delete-at"`
+	// Metadata is stored as X-Object-Meta-* headers of the object.
+	Metadata map[string]string `yaml:"metadata"`
+
+	checksum *Checksum
+	size     int64
+}
+
+func (s *SwiftWriteParams) Name() string {
+	return s.ObjectName
 }
 
 func (s *SwiftWriteParams) SetName(name string) {
 	s.ObjectName = name
 }
 
+func (s *SwiftWriteParams) SetMetadata(metadata map[string]string) {
+	mergeMetadata(&s.Metadata, metadata)
+}
+
+func (s *SwiftWriteParams) SetChecksum(checksum *Checksum) {
+	s.checksum = checksum
+}
+
+func (s *SwiftWriteParams) SetSize(size int64) {
+	s.size = size
+}
+
+// largeObject reports whether the content is uploaded as a Static Large Object,
+// content of known size up to the segment size is uploaded as a plain object.
+func (s *SwiftWriteParams) largeObject() bool {
+	return s.SegmentSize > 0 && (s.size <= 0 || s.size > int64(s.SegmentSize))
+}
+
+// expires reports whether Swift deletes the object after some time.
+func (s *SwiftWriteParams) expires() bool {
+	return s.DeleteAfter > 0 || !s.DeleteAt.IsZero()
+}
+
+// headers returns headers of the object with metadata and the expiry time counted from now.
+func (s *SwiftWriteParams) headers(now time.Time) swift.Headers {
+	headers := swift.Metadata(s.Metadata).ObjectHeaders()
+
+	deleteAt := s.DeleteAt
+	if s.DeleteAfter > 0 && (deleteAt.IsZero() || now.Add(s.DeleteAfter).Before(deleteAt)) {
+		deleteAt = now.Add(s.DeleteAfter)
+	}
+
+	if !deleteAt.IsZero() {
+		headers[swiftDeleteAtHeader] = strconv.FormatInt(deleteAt.Unix(), 10)
+	}
+
+	return headers
+}
+
+type SwiftObjectParams struct {
+	Container  string `yaml:"container"`
+	ObjectName string `yaml:"-"`
+}
+
+func (s *SwiftObjectParams) Name() string {
+	return s.ObjectName
+}
+
+func (s *SwiftObjectParams) SetName(name string) {
+	s.ObjectName = name
+}
+
+type SwiftListParams struct {
+	Container    string `yaml:"container"`
+	Prefix       string `yaml:"-"`
+	WithMetadata bool   `yaml:"-"`
+}
+
+func (s *SwiftListParams) SetPrefix(prefix string) {
+	s.Prefix = prefix
+}
+
+func (s *SwiftListParams) SetWithMetadata(withMetadata bool) {
+	s.WithMetadata = withMetadata
+}
+
 type SwiftStorage struct {
 	conn *swift.Connection
 }
@@ -110,25 +224,270 @@ func (s *SwiftStorage) Write(ctx context.Context, content io.Reader, params Writ
 
 	err := s.putObject(ctx, content, swiftParams)
 	if err != nil {
-		return fmt.Errorf("write to swift storage: %v", err)
+		return fmt.Errorf("write to swift storage: %w", err)
 	}
 
 	return nil
 }
 
+// putObject uploads content as a plain object or as a Static Large Object. The SHA-256 of the checksum is stored
+// in metadata, it is sent with the object when it is known before the upload.
 func (s *SwiftStorage) putObject(ctx context.Context, content io.Reader, swiftParams *SwiftWriteParams) error {
-	checkHash := swiftParams.Hash != ""
+	headers := swiftParams.headers(time.Now())
+
+	checksum := swiftParams.checksum
+	if checksum == nil {
+		checksum = NewChecksum(content)
+		content = checksum
+	}
+
+	if checksum.knownSHA256() != "" {
+		addChecksumHeader(headers, checksum.knownSHA256())
+	}
+
+	if swiftParams.largeObject() {
+		// ETag of a Static Large Object is a hash of its segment hashes, which Swift checks itself
+		err := s.putLargeObject(ctx, content, swiftParams, headers)
+		if err != nil {
+			return err
+		}
+	} else {
+		checkHash := swiftParams.Hash != ""
+
+		objectHeaders, err := s.conn.ObjectPut(
+			ctx,
+			swiftParams.Container,
+			swiftParams.ObjectName,
+			content,
+			checkHash,
+			swiftParams.Hash,
+			swiftParams.ContentType,
+			headers,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = checksum.VerifyETag(objectHeaders["Etag"])
+		if err != nil {
+			return err
+		}
+	}
+
+	// The SHA-256 of a streamed backup is known only after the upload
+	if swiftParams.checksum != nil && checksum.knownSHA256() == "" {
+		s.addChecksum(ctx, swiftParams, checksum, headers)
+	}
+
+	return nil
+}
+
+// addChecksum adds the SHA-256 to metadata of the uploaded object. The update replaces all metadata
+// and the expiry of the object, so they are sent again. The object is already uploaded and verified,
+// so a failed update is only logged, the backup is verified without it.
+func (s *SwiftStorage) addChecksum(ctx context.Context, swiftParams *SwiftWriteParams, checksum *Checksum, headers swift.Headers) {
+	addChecksumHeader(headers, checksum.SHA256())
+
+	err := s.conn.ObjectUpdate(ctx, swiftParams.Container, swiftParams.ObjectName, headers)
+	if err != nil {
+		log.Warn("Failed to add checksum to metadata", "name", swiftParams.ObjectName, "err", err)
+	}
+}
+
+// addChecksumHeader adds the SHA-256 to headers as metadata of the object.
+func addChecksumHeader(headers swift.Headers, sha256 string) {
+	for key, value := range (swift.Metadata{MetadataSha256: sha256}).ObjectHeaders() {
+		headers[key] = value
+	}
+}
+
+// putLargeObject uploads the content as a Static Large Object, segments of a replaced object are removed.
+func (s *SwiftStorage) putLargeObject(
+	ctx context.Context,
+	content io.Reader,
+	swiftParams *SwiftWriteParams,
+	headers swift.Headers,
+) error {
+	segmentContainer := swiftParams.SegmentContainer
+	if segmentContainer == "" {
+		segmentContainer = swiftParams.Container + swiftSegmentContainerSuffix
+	}
+
+	err := s.ensureContainer(ctx, segmentContainer)
+	if err != nil {
+		return fmt.Errorf("ensure segment container: %w", err)
+	}
+
+	largeObject, err := s.conn.StaticLargeObjectCreate(ctx, &swift.LargeObjectOpts{
+		Container:        swiftParams.Container,
+		ObjectName:       swiftParams.ObjectName,
+		ContentType:      swiftParams.ContentType,
+		Headers:          headers,
+		ChunkSize:        int64(swiftParams.SegmentSize),
+		SegmentContainer: segmentContainer,
+	})
+	if err != nil {
+		return fmt.Errorf("create large object: %w", err)
+	}
+
+	_, err = io.Copy(largeObject, &contextReader{ctx: ctx, reader: content})
+	if err != nil {
+		return fmt.Errorf("upload segments: %w", err)
+	}
+
+	err = largeObject.CloseWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	deleteAt, expires := headers[swiftDeleteAtHeader]
+	if !expires {
+		return nil
+	}
+
+	// Segments are uploaded without headers of the manifest, they must expire with it
+	_, segments, err := s.conn.LargeObjectGetSegments(ctx, swiftParams.Container, swiftParams.ObjectName)
+	if err != nil {
+		return fmt.Errorf("get segments: %w", err)
+	}
+
+	for _, segment := range segments {
+		err = s.conn.ObjectUpdate(ctx, segmentContainer, segment.Name, swift.Headers{swiftDeleteAtHeader: deleteAt})
+		if err != nil {
+			return fmt.Errorf("expire segment %s: %w", segment.Name, err)
+		}
+	}
+
+	return nil
+}
 
-	_, err := s.conn.ObjectPut(
+// ensureContainer creates the container if it does not exist.
+func (s *SwiftStorage) ensureContainer(ctx context.Context, container string) error {
+	_, _, err := s.conn.Container(ctx, container)
+	if !errors.Is(err, swift.ContainerNotFound) {
+		return err
+	}
+
+	return s.conn.ContainerCreate(ctx, container, nil)
+}
+
+func (s *SwiftStorage) Read(ctx context.Context, out io.Writer, params ObjectParams) error {
+	swiftParams, ok := params.(*SwiftObjectParams)
+	if !ok {
+		return errors.New("params is not of type *SwiftObjectParams")
+	}
+
+	err := s.getObject(ctx, out, swiftParams)
+	if err != nil {
+		return fmt.Errorf("read from swift storage: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SwiftStorage) getObject(ctx context.Context, out io.Writer, swiftParams *SwiftObjectParams) error {
+	_, err := s.conn.ObjectGet(
 		ctx,
 		swiftParams.Container,
 		swiftParams.ObjectName,
-		content,
-		checkHash,
-		swiftParams.Hash,
-		swiftParams.ContentType,
+		out,
+		true,
 		nil,
 	)
+	if errors.Is(err, swift.ObjectNotFound) {
+		return fmt.Errorf("%s: %w", swiftParams.ObjectName, ErrorObjectNotFound)
+	}
 
 	return err
 }
+
+func (s *SwiftStorage) List(ctx context.Context, params ListParams) ([]Object, error) {
+	swiftParams, ok := params.(*SwiftListParams)
+	if !ok {
+		return nil, errors.New("params is not of type *SwiftListParams")
+	}
+
+	objects, err := s.listObjects(ctx, swiftParams)
+	if err != nil {
+		return nil, fmt.Errorf("list swift storage: %w", err)
+	}
+
+	return objects, nil
+}
+
+func (s *SwiftStorage) listObjects(ctx context.Context, swiftParams *SwiftListParams) ([]Object, error) {
+	swiftObjects, err := s.conn.ObjectsAll(ctx, swiftParams.Container, &swift.ObjectsOpts{Prefix: swiftParams.Prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]Object, 0, len(swiftObjects))
+
+	for _, swiftObject := range swiftObjects {
+		if swiftObject.PseudoDirectory {
+			continue
+		}
+
+		object := Object{
+			Name:         swiftObject.Name,
+			Size:         swiftObject.Bytes,
+			LastModified: swiftObject.LastModified,
+			Hash:         swiftObject.Hash,
+		}
+
+		if swiftParams.WithMetadata {
+			// Container listing does not contain metadata, so each object has to be requested separately
+			_, headers, err := s.conn.Object(ctx, swiftParams.Container, swiftObject.Name)
+			if err != nil {
+				return nil, fmt.Errorf("head object %s: %w", swiftObject.Name, err)
+			}
+
+			object.Metadata = headers.ObjectMetadata()
+		}
+
+		objects = append(objects, object)
+	}
+
+	return objects, nil
+}
+
+func (s *SwiftStorage) Delete(ctx context.Context, params ObjectParams) error {
+	swiftParams, ok := params.(*SwiftObjectParams)
+	if !ok {
+		return errors.New("params is not of type *SwiftObjectParams")
+	}
+
+	// LargeObjectDelete removes segments of large objects together with the manifest, and plain objects as is
+	err := s.conn.LargeObjectDelete(ctx, swiftParams.Container, swiftParams.ObjectName)
+	if errors.Is(err, swift.ObjectNotFound) {
+		return fmt.Errorf("delete from swift storage: %s: %w", swiftParams.ObjectName, ErrorObjectNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("delete from swift storage: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SwiftStorage) Stat(ctx context.Context, params ObjectParams) (Object, error) {
+	swiftParams, ok := params.(*SwiftObjectParams)
+	if !ok {
+		return Object{}, errors.New("params is not of type *SwiftObjectParams")
+	}
+
+	swiftObject, headers, err := s.conn.Object(ctx, swiftParams.Container, swiftParams.ObjectName)
+	if errors.Is(err, swift.ObjectNotFound) {
+		return Object{}, fmt.Errorf("stat in swift storage: %s: %w", swiftParams.ObjectName, ErrorObjectNotFound)
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("stat in swift storage: %w", err)
+	}
+
+	return Object{
+		Name:         swiftObject.Name,
+		Size:         swiftObject.Bytes,
+		LastModified: swiftObject.LastModified,
+		Hash:         swiftObject.Hash,
+		Metadata:     headers.ObjectMetadata(),
+	}, nil
+}
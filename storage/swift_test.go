@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/FirinKinuo/capyback/bytesize"
+)
+
+func TestSwiftWriteParamsLargeObject(t *testing.T) {
+	tests := []struct {
+		name        string
+		segmentSize bytesize.Size
+		size        int64
+		want        bool
+	}{
+		{name: "no segment size", size: int64(10 * bytesize.GiB), want: false},
+		{name: "unknown size", segmentSize: bytesize.GiB, want: true},
+		{name: "size under segment size", segmentSize: bytesize.GiB, size: int64(bytesize.MiB), want: false},
+		{name: "size of segment size", segmentSize: bytesize.GiB, size: int64(bytesize.GiB), want: false},
+		{name: "size over segment size", segmentSize: bytesize.GiB, size: int64(bytesize.GiB) + 1, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &SwiftWriteParams{SegmentSize: tt.segmentSize}
+			params.SetSize(tt.size)
+
+			if got := params.largeObject(); got != tt.want {
+				t.Errorf("largeObject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}